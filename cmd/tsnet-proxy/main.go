@@ -7,16 +7,19 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/NathanBhanji/tsnet-proxy/internal/config"
 	"github.com/NathanBhanji/tsnet-proxy/internal/health"
 	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
 	"github.com/NathanBhanji/tsnet-proxy/internal/metrics"
+	"github.com/NathanBhanji/tsnet-proxy/internal/reload"
 	"github.com/NathanBhanji/tsnet-proxy/internal/ui"
 )
 
 var (
-	configPath = flag.String("config", "configs/services.yaml", "Path to configuration file")
+	configPath  = flag.String("config", "configs/services.yaml", "Path to configuration file")
+	watchConfig = flag.Bool("watch-config", true, "Reload the configuration file when it changes")
 )
 
 func main() {
@@ -36,6 +39,12 @@ func main() {
 
 	// Create manager
 	mgr := manager.NewManager(cfg.AuthKey, cfg.StateDir, cfg.APIKey, cfg.Tailnet)
+	mgr.SetGroups(cfg.Groups)
+
+	// Record request metrics for every service
+	if cfg.Metrics.Enabled {
+		mgr.Use(metrics.MetricsMiddleware)
+	}
 
 	// Add all configured services
 	for _, svcCfg := range cfg.Services {
@@ -52,8 +61,14 @@ func main() {
 	healthChecker := health.NewChecker(mgr)
 	healthChecker.Start(ctx)
 
+	// Watch configuration for changes
+	reloader := reload.NewReloader(cfg, *configPath, mgr)
+	if *watchConfig {
+		go reloader.Watch(ctx, 2*time.Second)
+	}
+
 	// Start management UI
-	uiServer := ui.NewUIServer(cfg, *configPath, mgr, healthChecker, cfg.AuthKey, cfg.StateDir)
+	uiServer := ui.NewUIServer(cfg, reloader, mgr, healthChecker, cfg.AuthKey, cfg.StateDir)
 	if err := uiServer.Start(); err != nil {
 		log.Fatalf("Failed to start management UI: %v", err)
 	}
@@ -66,11 +81,17 @@ func main() {
 
 	log.Printf("tsnet-proxy started successfully")
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, reloading configuration on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-	<-sigChan
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Printf("Received SIGHUP, reloading configuration")
+		reloader.Reload()
+	}
 	log.Printf("Received shutdown signal")
 
 	// Graceful shutdown
@@ -0,0 +1,118 @@
+package access
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+// Check evaluates the access rules for a caller requesting path. Deny rules
+// take precedence; when allow rules are present the caller must match one
+// of them. It returns a human readable reason when access is denied.
+func Check(cfg config.AccessConfig, groups config.Groups, who *apitype.WhoIsResponse, reqPath string) (bool, string) {
+	allow, deny := cfg.Allow, cfg.Deny
+
+	// Evaluate the cleaned path so dot segments cannot dodge path rules
+	reqPath = path.Clean("/" + reqPath)
+
+	// The longest matching path rule replaces the service-wide rules
+	longest := -1
+	for _, rule := range cfg.Paths {
+		if HasPathPrefix(reqPath, rule.Prefix) && len(rule.Prefix) > longest {
+			longest = len(rule.Prefix)
+			allow, deny = rule.Allow, rule.Deny
+		}
+	}
+
+	if !deny.IsEmpty() && Matches(deny, groups, who) {
+		return false, fmt.Sprintf("%s is denied access to %s", Describe(who), reqPath)
+	}
+	if !allow.IsEmpty() && !Matches(allow, groups, who) {
+		return false, fmt.Sprintf("%s is not allowed to access %s", Describe(who), reqPath)
+	}
+	return true, ""
+}
+
+// Matches reports whether the caller matches any identity listed in m,
+// resolving group names against groups
+func Matches(m config.AccessMatch, groups config.Groups, who *apitype.WhoIsResponse) bool {
+	if who == nil {
+		return false
+	}
+
+	// Tagged nodes are not owned by a user, so only their tags are considered
+	tagged := who.Node != nil && len(who.Node.Tags) > 0
+	if !tagged && who.UserProfile != nil {
+		login := who.UserProfile.LoginName
+		for _, user := range m.Users {
+			if matchLogin(user, login) {
+				return true
+			}
+		}
+		for _, group := range m.Groups {
+			for _, member := range groups[group] {
+				if matchLogin(member, login) {
+					return true
+				}
+			}
+		}
+	}
+
+	if who.Node != nil {
+		for _, tag := range m.Tags {
+			for _, nodeTag := range who.Node.Tags {
+				if tag == nodeTag {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, capability := range m.Capabilities {
+		if who.CapMap.HasCapability(tailcfg.PeerCapability(capability)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Describe returns a short description of the caller for logs and errors
+func Describe(who *apitype.WhoIsResponse) string {
+	if who == nil {
+		return "unknown caller"
+	}
+	if who.Node != nil && len(who.Node.Tags) > 0 {
+		return fmt.Sprintf("%s (%s)", strings.TrimSuffix(who.Node.Name, "."), strings.Join(who.Node.Tags, ","))
+	}
+	if who.UserProfile != nil {
+		return who.UserProfile.LoginName
+	}
+	return "unknown caller"
+}
+
+// matchLogin matches a login name against an exact name, "*@domain" or "*"
+func matchLogin(pattern, login string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if domain, ok := strings.CutPrefix(pattern, "*@"); ok {
+		return strings.HasSuffix(strings.ToLower(login), "@"+strings.ToLower(domain))
+	}
+	return strings.EqualFold(pattern, login)
+}
+
+// HasPathPrefix reports whether path is prefix or lies below it, respecting
+// path segment boundaries so that /api does not match /apifoo. A trailing
+// slash on prefix is ignored, so /admin/ also matches the cleaned /admin.
+func HasPathPrefix(reqPath, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || reqPath == prefix {
+		return true
+	}
+	return strings.HasPrefix(reqPath, prefix+"/")
+}
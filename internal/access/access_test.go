@@ -0,0 +1,108 @@
+package access
+
+import (
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		reqPath string
+		prefix  string
+		want    bool
+	}{
+		{"/admin", "/admin", true},
+		{"/admin/", "/admin", true},
+		{"/admin/x", "/admin", true},
+		{"/administrator", "/admin", false},
+		{"/admin", "/admin/", true},
+		{"/admin/", "/admin/", true},
+		{"/admin/x", "/admin/", true},
+		{"/administrator", "/admin/", false},
+		{"/", "/", true},
+		{"/anything", "/", true},
+		{"/", "/admin", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasPathPrefix(tt.reqPath, tt.prefix); got != tt.want {
+			t.Errorf("HasPathPrefix(%q, %q) = %v, want %v", tt.reqPath, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPathRules(t *testing.T) {
+	alice := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "laptop.example.ts.net."},
+		UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+	}
+	bob := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "desktop.example.ts.net."},
+		UserProfile: &tailcfg.UserProfile{LoginName: "bob@example.com"},
+	}
+
+	for _, prefix := range []string{"/admin", "/admin/"} {
+		cfg := config.AccessConfig{
+			Allow: config.AccessMatch{Users: []string{"*"}},
+			Paths: []config.PathAccessConfig{
+				{Prefix: prefix, Allow: config.AccessMatch{Users: []string{"alice@example.com"}}},
+			},
+		}
+
+		tests := []struct {
+			reqPath string
+			who     *apitype.WhoIsResponse
+			want    bool
+		}{
+			{"/admin", alice, true},
+			{"/admin", bob, false},
+			{"/admin/", bob, false},
+			{"/admin/x", bob, false},
+			{"/admin/../admin/x", bob, false},
+			{"/administrator", bob, true},
+			{"/", bob, true},
+		}
+
+		for _, tt := range tests {
+			if got, _ := Check(cfg, nil, tt.who, tt.reqPath); got != tt.want {
+				t.Errorf("prefix %q: Check(%s, %q) = %v, want %v", prefix, Describe(tt.who), tt.reqPath, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	groups := config.Groups{"admins": {"alice@example.com"}}
+	user := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "laptop."},
+		UserProfile: &tailcfg.UserProfile{LoginName: "Alice@Example.com"},
+	}
+	tagged := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "ci.", Tags: []string{"tag:ci"}},
+		UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+	}
+
+	tests := []struct {
+		name  string
+		match config.AccessMatch
+		who   *apitype.WhoIsResponse
+		want  bool
+	}{
+		{"exact user", config.AccessMatch{Users: []string{"alice@example.com"}}, user, true},
+		{"domain wildcard", config.AccessMatch{Users: []string{"*@example.com"}}, user, true},
+		{"other domain", config.AccessMatch{Users: []string{"*@other.com"}}, user, false},
+		{"group", config.AccessMatch{Groups: []string{"admins"}}, user, true},
+		{"tag", config.AccessMatch{Tags: []string{"tag:ci"}}, tagged, true},
+		{"tagged node ignores owner", config.AccessMatch{Users: []string{"alice@example.com"}}, tagged, false},
+		{"unknown caller", config.AccessMatch{Users: []string{"*"}}, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.match, groups, tt.who); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
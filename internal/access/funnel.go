@@ -0,0 +1,52 @@
+package access
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// FunnelPathAllowed reports whether a Funnel request may reach reqPath
+func FunnelPathAllowed(cfg config.FunnelConfig, reqPath string) bool {
+	if len(cfg.Paths) == 0 {
+		return true
+	}
+
+	reqPath = path.Clean("/" + reqPath)
+	for _, prefix := range cfg.Paths {
+		if HasPathPrefix(reqPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FunnelAuthorized reports whether a Funnel request presents one of the
+// configured basic auth credentials or bearer tokens
+func FunnelAuthorized(cfg config.FunnelAuthConfig, r *http.Request) bool {
+	if !cfg.Required() {
+		return true
+	}
+
+	if user, password, ok := r.BasicAuth(); ok {
+		expected, exists := cfg.Users[user]
+		return exists && secureEqual(password, expected)
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, expected := range cfg.Tokens {
+			if secureEqual(token, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// secureEqual compares secrets in constant time
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -1,9 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +23,11 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	return Parse(data)
+}
+
+// Parse parses and validates configuration file content
+func Parse(data []byte) (*Config, error) {
 	// Expand environment variables
 	expanded := os.ExpandEnv(string(data))
 
@@ -28,23 +41,87 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	// Keep the unexpanded document so Save can preserve placeholders
+	doc, err := parseDocument(data, cfg.Services)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	cfg.doc = doc
+
 	return &cfg, nil
 }
 
-// Save writes the configuration to a file
+// Save writes the configuration to a file. Configurations returned by Load
+// only have their services rewritten; comments, key order and ${ENV}
+// placeholders of the original file are preserved.
 func Save(cfg *Config, path string) error {
-	data, err := yaml.Marshal(cfg)
+	var data []byte
+	var err error
+	if cfg.doc != nil {
+		if err = cfg.doc.setServices(cfg.Services); err == nil {
+			data, err = cfg.doc.marshal()
+		}
+	} else {
+		data, err = yaml.Marshal(cfg)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	// Keep the permissions of an existing file
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	return WriteFile(path, data, perm)
+}
+
+// WriteFile atomically replaces path with data by writing to a temporary
+// file in the same directory and renaming it into place
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to set config file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		// A file bind-mounted into a container cannot be replaced by
+		// rename, so fall back to rewriting it in place
+		if errors.Is(err, syscall.EBUSY) {
+			if err := os.WriteFile(path, data, perm); err != nil {
+				return fmt.Errorf("failed to write config file: %w", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
 
 	return nil
 }
 
+// CopyDocument makes subsequent saves of c preserve the source document of
+// src, which is used when a reloaded configuration replaces the live one
+func (c *Config) CopyDocument(src *Config) {
+	c.doc = src.doc
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	if c.AuthKey == "" {
@@ -55,6 +132,13 @@ func (c *Config) Validate() error {
 		c.StateDir = "/data/tsnet"
 	}
 
+	if c.HistorySize < 0 {
+		return fmt.Errorf("historySize must not be negative")
+	}
+	if c.HistorySize == 0 {
+		c.HistorySize = 20
+	}
+
 	// Validate services
 	serviceNames := make(map[string]bool)
 	for i, svc := range c.Services {
@@ -67,19 +151,137 @@ func (c *Config) Validate() error {
 		}
 		serviceNames[svc.Name] = true
 
-		if svc.Backend == "" {
+		if svc.Backend == "" && len(svc.Backends) == 0 && len(svc.Routes) == 0 {
 			return fmt.Errorf("service %s: backend URL is required", svc.Name)
 		}
 
-		if !strings.HasPrefix(svc.Backend, "http://") && !strings.HasPrefix(svc.Backend, "https://") {
-			return fmt.Errorf("service %s: backend URL must start with http:// or https://", svc.Name)
+		if svc.Backend != "" && len(svc.Backends) > 0 {
+			return fmt.Errorf("service %s: backend and backends are mutually exclusive", svc.Name)
+		}
+
+		// Validate service mode
+		switch svc.Mode {
+		case "":
+			// Checks below read the mode from svc
+			c.Services[i].Mode = ModeHTTP
+			svc.Mode = ModeHTTP
+		case ModeHTTP:
+		case ModeTCP:
+			if err := validateL4Service(svc); err != nil {
+				return fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+			if svc.IdleTimeout == 0 {
+				c.Services[i].IdleTimeout = 5 * time.Minute
+			}
+		case ModeUDP:
+			if err := validateL4Service(svc); err != nil {
+				return fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+			if svc.HealthCheck.Enabled {
+				return fmt.Errorf("service %s: healthCheck is not supported in udp mode", svc.Name)
+			}
+			if svc.IdleTimeout == 0 {
+				c.Services[i].IdleTimeout = time.Minute
+			}
+		default:
+			return fmt.Errorf("service %s: unknown mode %q", svc.Name, svc.Mode)
+		}
+		if !svc.IsL4() && len(svc.Ports) > 0 {
+			return fmt.Errorf("service %s: ports are only supported in tcp and udp modes", svc.Name)
+		}
+		if err := validateListeners(c.Services[i]); err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		if err := validateHTTPS(&c.Services[i]); err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		if err := validateFunnel(&c.Services[i]); err != nil {
+			return fmt.Errorf("service %s: funnel: %w", svc.Name, err)
+		}
+		if svc.IdleTimeout < 0 {
+			return fmt.Errorf("service %s: idleTimeout must not be negative", svc.Name)
+		}
+
+		scheme := "http"
+		if svc.IsL4() {
+			scheme = svc.Mode
+		}
+		if err := validateBackends(c.Services[i].Backends, svc.BackendList(), scheme, &c.Services[i].LoadBalancing); err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+
+		// Validate rewrites
+		if len(svc.Rewrites) > 0 && svc.Mode != ModeHTTP {
+			return fmt.Errorf("service %s: rewrites are only supported in http mode", svc.Name)
+		}
+		if err := validateRewrites(svc.Rewrites); err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+
+		if svc.ResponseRewrite.Enabled && svc.Mode != ModeHTTP {
+			return fmt.Errorf("service %s: responseRewrite is only supported in http mode", svc.Name)
+		}
+		if svc.ResponseRewrite.Body && !svc.ResponseRewrite.Enabled {
+			return fmt.Errorf("service %s: responseRewrite.body requires responseRewrite.enabled", svc.Name)
+		}
+
+		if err := validateHostHeader(&c.Services[i].HostHeader); err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		for _, proxy := range svc.TrustedProxies {
+			if _, err := ParseTrustedProxy(proxy); err != nil {
+				return fmt.Errorf("service %s: trustedProxies: %w", svc.Name, err)
+			}
+		}
+
+		// Validate header rules
+		if (!svc.RequestHeaders.IsEmpty() || !svc.ResponseHeaders.IsEmpty()) && svc.Mode != ModeHTTP {
+			return fmt.Errorf("service %s: requestHeaders and responseHeaders are only supported in http mode", svc.Name)
+		}
+		if err := validateHeaderRules(svc.RequestHeaders); err != nil {
+			return fmt.Errorf("service %s: requestHeaders: %w", svc.Name, err)
+		}
+		if err := validateHeaderRules(svc.ResponseHeaders); err != nil {
+			return fmt.Errorf("service %s: responseHeaders: %w", svc.Name, err)
+		}
+
+		// Validate routes
+		if len(svc.Routes) > 0 && svc.Mode != ModeHTTP {
+			return fmt.Errorf("service %s: routes are only supported in http mode", svc.Name)
+		}
+		for j := range svc.Routes {
+			if err := validateRoute(&c.Services[i].Routes[j]); err != nil {
+				return fmt.Errorf("service %s: route %d: %w", svc.Name, j, err)
+			}
+		}
+
+		// Validate access rules
+		if err := c.validateAccessMatch(svc.Access.Allow); err != nil {
+			return fmt.Errorf("service %s: access.allow: %w", svc.Name, err)
+		}
+		if err := c.validateAccessMatch(svc.Access.Deny); err != nil {
+			return fmt.Errorf("service %s: access.deny: %w", svc.Name, err)
+		}
+		for _, rule := range svc.Access.Paths {
+			if !strings.HasPrefix(rule.Prefix, "/") {
+				return fmt.Errorf("service %s: access path prefix %q must start with /", svc.Name, rule.Prefix)
+			}
+			if err := c.validateAccessMatch(rule.Allow); err != nil {
+				return fmt.Errorf("service %s: access rule %s: allow: %w", svc.Name, rule.Prefix, err)
+			}
+			if err := c.validateAccessMatch(rule.Deny); err != nil {
+				return fmt.Errorf("service %s: access rule %s: deny: %w", svc.Name, rule.Prefix, err)
+			}
 		}
 
 		// Validate health check
 		if svc.HealthCheck.Enabled {
-			if svc.HealthCheck.Path == "" {
+			if svc.HealthCheck.Path == "" && svc.Mode != ModeTCP {
 				return fmt.Errorf("service %s: healthCheck.path is required when health checks are enabled", svc.Name)
 			}
+			if svc.HealthCheck.ExpectBody != "" && svc.Mode == ModeTCP {
+				return fmt.Errorf("service %s: healthCheck.expectBody is not supported in tcp mode", svc.Name)
+			}
 			if svc.HealthCheck.Interval == 0 {
 				c.Services[i].HealthCheck.Interval = 30 * 1000000000 // 30s default
 			}
@@ -89,9 +291,23 @@ func (c *Config) Validate() error {
 			if svc.HealthCheck.UnhealthyThreshold == 0 {
 				c.Services[i].HealthCheck.UnhealthyThreshold = 3
 			}
+			if svc.HealthCheck.HealthyThreshold == 0 {
+				c.Services[i].HealthCheck.HealthyThreshold = 1
+			}
+			if hc := c.Services[i].HealthCheck; hc.Interval <= 0 || hc.Timeout <= 0 {
+				return fmt.Errorf("service %s: healthCheck.interval and healthCheck.timeout must be positive", svc.Name)
+			}
 		}
 	}
 
+	// Validate management UI roles
+	if err := c.validateAccessMatch(c.ManagementUI.Admins); err != nil {
+		return fmt.Errorf("managementUI.admins: %w", err)
+	}
+	if err := c.validateAccessMatch(c.ManagementUI.Viewers); err != nil {
+		return fmt.Errorf("managementUI.viewers: %w", err)
+	}
+
 	// Set defaults for management UI
 	if c.ManagementUI.Enabled && c.ManagementUI.Hostname == "" {
 		c.ManagementUI.Hostname = "tsnet-proxy-ui"
@@ -107,3 +323,372 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// validateBackends checks a list of backends and the load balancing strategy
+// used across them. backends is the configured list, whose weights are
+// defaulted in place, and list includes a single backend URL if one is set.
+func validateBackends(backends, list []BackendConfig, scheme string, loadBalancing *string) error {
+	for j, backend := range list {
+		if scheme == "http" {
+			if !strings.HasPrefix(backend.URL, "http://") && !strings.HasPrefix(backend.URL, "https://") {
+				return fmt.Errorf("backend URL must start with http:// or https://")
+			}
+		} else if !strings.HasPrefix(backend.URL, scheme+"://") {
+			return fmt.Errorf("backend URL must start with %s:// in %s mode", scheme, scheme)
+		}
+		if backend.Weight < 0 {
+			return fmt.Errorf("backend %d weight must not be negative", j)
+		}
+		if backend.Weight == 0 && len(backends) > 0 {
+			backends[j].Weight = 1
+		}
+	}
+
+	switch *loadBalancing {
+	case "":
+		*loadBalancing = LoadBalancingRoundRobin
+	case LoadBalancingRoundRobin, LoadBalancingLeastConnections,
+		LoadBalancingRandomTwoChoices, LoadBalancingWeighted:
+	default:
+		return fmt.Errorf("unknown loadBalancing strategy %q", *loadBalancing)
+	}
+	return nil
+}
+
+// validateRoute checks a route and normalizes its methods
+func validateRoute(route *RouteConfig) error {
+	if err := validateRewrites(route.Rewrites); err != nil {
+		return err
+	}
+	if route.Backend == "" && len(route.Backends) == 0 && !redirectsAll(route.Rewrites) {
+		return fmt.Errorf("backend URL is required")
+	}
+	if route.Backend != "" && len(route.Backends) > 0 {
+		return fmt.Errorf("backend and backends are mutually exclusive")
+	}
+	if err := validateBackends(route.Backends, route.BackendList(), "http", &route.LoadBalancing); err != nil {
+		return err
+	}
+
+	match := &route.Match
+	paths := 0
+	for _, p := range []string{match.PathPrefix, match.Path, match.PathRegex} {
+		if p != "" {
+			paths++
+		}
+	}
+	if paths > 1 {
+		return fmt.Errorf("only one of pathPrefix, path and pathRegex may be set")
+	}
+	if match.PathPrefix != "" && !strings.HasPrefix(match.PathPrefix, "/") {
+		return fmt.Errorf("pathPrefix %q must start with /", match.PathPrefix)
+	}
+	if match.Path != "" && !strings.HasPrefix(match.Path, "/") {
+		return fmt.Errorf("path %q must start with /", match.Path)
+	}
+	if match.PathRegex != "" {
+		if _, err := regexp.Compile(match.PathRegex); err != nil {
+			return fmt.Errorf("invalid pathRegex: %w", err)
+		}
+	}
+	if route.StripPrefix && match.PathPrefix == "" {
+		return fmt.Errorf("stripPrefix requires pathPrefix")
+	}
+
+	for j, method := range match.Methods {
+		if method == "" {
+			return fmt.Errorf("empty method")
+		}
+		match.Methods[j] = strings.ToUpper(method)
+	}
+	for name := range match.Headers {
+		if name == "" {
+			return fmt.Errorf("empty header name")
+		}
+	}
+	return nil
+}
+
+// validateHostHeader checks the Host header mode and defaults it to preserve
+func validateHostHeader(host *HostHeaderConfig) error {
+	switch host.Mode {
+	case "":
+		host.Mode = HostHeaderPreserve
+	case HostHeaderPreserve, HostHeaderBackend, HostHeaderCustom:
+	default:
+		return fmt.Errorf("unknown hostHeader mode %q", host.Mode)
+	}
+
+	if host.Mode == HostHeaderCustom {
+		if host.Value == "" || strings.ContainsAny(host.Value, " /\t\r\n") {
+			return fmt.Errorf("hostHeader value %q must be a host name", host.Value)
+		}
+	} else if host.Value != "" {
+		return fmt.Errorf("hostHeader value requires custom mode")
+	}
+	return nil
+}
+
+// ParseTrustedProxy parses an IP address or CIDR prefix
+func ParseTrustedProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// validateRewrites checks rewrite rules and defaults redirect codes to 308
+func validateRewrites(rules []RewriteRule) error {
+	for i := range rules {
+		rule := &rules[i]
+
+		actions := 0
+		for _, a := range []string{rule.Replace, rule.AddPrefix, rule.Redirect} {
+			if a != "" {
+				actions++
+			}
+		}
+		if actions != 1 {
+			return fmt.Errorf("rewrite %d: exactly one of replace, addPrefix and redirect must be set", i)
+		}
+
+		if rule.Match != "" {
+			if _, err := regexp.Compile(rule.Match); err != nil {
+				return fmt.Errorf("rewrite %d: invalid match: %w", i, err)
+			}
+		} else if rule.Replace != "" {
+			return fmt.Errorf("rewrite %d: replace requires match", i)
+		}
+
+		if rule.AddPrefix != "" && (!strings.HasPrefix(rule.AddPrefix, "/") || strings.HasSuffix(rule.AddPrefix, "/")) {
+			return fmt.Errorf("rewrite %d: addPrefix %q must start and not end with /", i, rule.AddPrefix)
+		}
+
+		if rule.Redirect == "" {
+			if rule.Code != 0 {
+				return fmt.Errorf("rewrite %d: code requires redirect", i)
+			}
+			continue
+		}
+		switch rule.Code {
+		case 0:
+			rule.Code = http.StatusPermanentRedirect
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("rewrite %d: redirect code must be 301, 302, 307 or 308", i)
+		}
+	}
+	return nil
+}
+
+// redirectsAll reports whether rules contain a redirect that matches every
+// path, so requests never reach a backend
+func redirectsAll(rules []RewriteRule) bool {
+	for _, rule := range rules {
+		if rule.Redirect != "" && rule.Match == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateL4Service checks the settings of a tcp or udp mode service
+func validateL4Service(svc ServiceConfig) error {
+	if len(svc.Ports) == 0 && len(svc.Listeners) == 0 {
+		return fmt.Errorf("ports or listeners are required in %s mode", svc.Mode)
+	}
+	seen := make(map[int]bool)
+	for _, port := range svc.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+		if seen[port] {
+			return fmt.Errorf("duplicate port %d", port)
+		}
+		seen[port] = true
+	}
+
+	// HTTP features have no meaning for raw connections
+	if len(svc.Paths) > 0 || svc.StripPrefix {
+		return fmt.Errorf("paths and stripPrefix are not supported in %s mode", svc.Mode)
+	}
+	if svc.IdentityHeaders {
+		return fmt.Errorf("identityHeaders is not supported in %s mode", svc.Mode)
+	}
+	if svc.Access.Enabled() {
+		return fmt.Errorf("access rules are not supported in %s mode", svc.Mode)
+	}
+	if svc.TLS.Enabled {
+		return fmt.Errorf("tls is not supported in %s mode", svc.Mode)
+	}
+
+	for _, backend := range svc.BackendList() {
+		u, err := url.Parse(backend.URL)
+		if err != nil || u.Hostname() == "" {
+			return fmt.Errorf("invalid backend URL %s", backend.URL)
+		}
+	}
+	return nil
+}
+
+// validateListeners checks the listeners of a service. Listeners without a
+// backend must suit the service's mode; the others must suit their backend.
+func validateListeners(svc ServiceConfig) error {
+	if len(svc.Listeners) == 0 {
+		return nil
+	}
+	if svc.Mode == ModeUDP {
+		return fmt.Errorf("listeners are not supported in udp mode, use ports")
+	}
+	if len(svc.Ports) > 0 {
+		return fmt.Errorf("ports and listeners are mutually exclusive")
+	}
+
+	seen := make(map[int]bool)
+	for _, l := range svc.Listeners {
+		if l.Port < 1 || l.Port > 65535 {
+			return fmt.Errorf("invalid listener port %d", l.Port)
+		}
+		if seen[l.Port] {
+			return fmt.Errorf("duplicate listener port %d", l.Port)
+		}
+		seen[l.Port] = true
+
+		switch l.Protocol {
+		case ListenerHTTP, ListenerHTTPS, ListenerTCP, ListenerTLS:
+		default:
+			return fmt.Errorf("listener %d: unknown protocol %q", l.Port, l.Protocol)
+		}
+
+		if l.Backend == "" {
+			if l.IsHTTP() == svc.IsL4() {
+				return fmt.Errorf("listener %d: %s listeners need a backend in %s mode", l.Port, l.Protocol, svc.Mode)
+			}
+			continue
+		}
+
+		if l.IsHTTP() {
+			if !strings.HasPrefix(l.Backend, "http://") && !strings.HasPrefix(l.Backend, "https://") {
+				return fmt.Errorf("listener %d: backend URL must start with http:// or https://", l.Port)
+			}
+		} else if u, err := url.Parse(l.Backend); err != nil || u.Scheme != "tcp" || u.Port() == "" {
+			return fmt.Errorf("listener %d: backend URL must be tcp://host:port", l.Port)
+		}
+	}
+	return nil
+}
+
+// validateHTTPS checks the HTTP redirect and HSTS settings of a service and
+// sets their defaults
+func validateHTTPS(svc *ServiceConfig) error {
+	redirect := &svc.HTTPRedirect
+	switch redirect.Mode {
+	case "", HTTPRedirectServe, HTTPRedirectRedirect, HTTPRedirectDisabled:
+	default:
+		return fmt.Errorf("unknown httpRedirect mode %q", redirect.Mode)
+	}
+
+	if redirect.Mode == HTTPRedirectRedirect {
+		switch redirect.Code {
+		case 0:
+			redirect.Code = http.StatusPermanentRedirect
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("httpRedirect code must be 301 or 308")
+		}
+
+		hasHTTPS := false
+		for _, l := range svc.ListenerList() {
+			if l.Protocol == ListenerHTTPS && l.Backend == "" {
+				hasHTTPS = true
+			}
+		}
+		if !hasHTTPS {
+			return fmt.Errorf("httpRedirect needs an https listener")
+		}
+	}
+
+	if svc.HSTS.MaxAge < 0 {
+		return fmt.Errorf("hsts.maxAge must not be negative")
+	}
+	if svc.HSTS.Enabled && svc.HSTS.MaxAge == 0 {
+		svc.HSTS.MaxAge = 31536000 // One year
+	}
+	return nil
+}
+
+// validateFunnel checks the Funnel settings of a service and sets their defaults
+func validateFunnel(svc *ServiceConfig) error {
+	funnel := &svc.Funnel
+	if !funnel.Enabled {
+		return nil
+	}
+	if svc.Mode != ModeHTTP {
+		return fmt.Errorf("only supported in http mode")
+	}
+
+	switch funnel.Port {
+	case 0:
+		funnel.Port = 443
+	case 443, 8443, 10000:
+	default:
+		return fmt.Errorf("port must be 443, 8443 or 10000")
+	}
+
+	// The Funnel port is shared with a tailnet HTTPS listener on the same port
+	for _, l := range svc.ListenerList() {
+		if l.Port == funnel.Port && (l.Protocol != ListenerHTTPS || l.Backend != "") {
+			return fmt.Errorf("port %d conflicts with the %s listener", funnel.Port, l.Protocol)
+		}
+	}
+
+	for _, prefix := range funnel.Paths {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("path %q must start with /", prefix)
+		}
+	}
+	for user, password := range funnel.Auth.Users {
+		if user == "" || password == "" {
+			return fmt.Errorf("auth users need a name and password")
+		}
+	}
+	for _, token := range funnel.Auth.Tokens {
+		if token == "" {
+			return fmt.Errorf("empty auth token")
+		}
+	}
+	return nil
+}
+
+// validateAccessMatch checks the identities listed in an access match
+func (c *Config) validateAccessMatch(m AccessMatch) error {
+	for _, user := range m.Users {
+		if user == "" {
+			return fmt.Errorf("empty user")
+		}
+	}
+	for _, group := range m.Groups {
+		if _, exists := c.Groups[group]; !exists {
+			return fmt.Errorf("unknown group %q", group)
+		}
+	}
+	for _, tag := range m.Tags {
+		if !strings.HasPrefix(tag, "tag:") {
+			return fmt.Errorf("tag %q must start with tag:", tag)
+		}
+	}
+	for _, capability := range m.Capabilities {
+		if capability == "" {
+			return fmt.Errorf("empty capability")
+		}
+	}
+	return nil
+}
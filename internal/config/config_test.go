@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateHealthCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthCheck HealthCheckConfig
+		wantErr     string
+	}{
+		{"defaults", HealthCheckConfig{Enabled: true, Path: "/health"}, ""},
+		{"explicit", HealthCheckConfig{Enabled: true, Path: "/health", Interval: 10 * time.Second, Timeout: time.Second}, ""},
+		{"negative interval", HealthCheckConfig{Enabled: true, Path: "/health", Interval: -time.Second}, "must be positive"},
+		{"negative timeout", HealthCheckConfig{Enabled: true, Path: "/health", Timeout: -time.Second}, "must be positive"},
+		{"missing path", HealthCheckConfig{Enabled: true}, "healthCheck.path is required"},
+		{"disabled", HealthCheckConfig{Interval: -time.Second}, ""},
+	}
+
+	for _, tt := range tests {
+		cfg := Config{
+			AuthKey:  "tskey-test",
+			Services: []ServiceConfig{{Name: "app", Backend: "http://app:80", HealthCheck: tt.healthCheck}},
+		}
+		err := cfg.Validate()
+
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: Validate: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: Validate error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+
+		if err == nil && tt.healthCheck.Enabled {
+			hc := cfg.Services[0].HealthCheck
+			if hc.Interval <= 0 || hc.Timeout <= 0 || hc.UnhealthyThreshold <= 0 || hc.HealthyThreshold <= 0 {
+				t.Errorf("%s: defaults not applied: %+v", tt.name, hc)
+			}
+		}
+	}
+}
+
+func TestValidateRouteBackends(t *testing.T) {
+	redirect := []RewriteRule{{Redirect: "https://new.example.com/"}}
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		wantErr bool
+	}{
+		{"backend", RouteConfig{Match: RouteMatch{PathPrefix: "/api"}, Backend: "http://api:80"}, false},
+		{"redirect only", RouteConfig{Match: RouteMatch{PathPrefix: "/old"}, Rewrites: redirect}, false},
+		{"conditional redirect only", RouteConfig{Match: RouteMatch{PathPrefix: "/old"}, Rewrites: []RewriteRule{{Match: "^/old/x$", Redirect: "/x"}}}, true},
+		{"neither", RouteConfig{Match: RouteMatch{PathPrefix: "/api"}}, true},
+	}
+
+	for _, tt := range tests {
+		cfg := Config{
+			AuthKey:  "tskey-test",
+			Services: []ServiceConfig{{Name: "app", Routes: []RouteConfig{tt.route}}},
+		}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// document is the parsed, unexpanded configuration file. It lets Save
+// rewrite only the services node while keeping comments, key order and
+// ${ENV} placeholders of everything else intact.
+type document struct {
+	root *yaml.Node
+	// services maps service names to their source node and the
+	// configuration that node produced when it was loaded
+	services map[string]documentService
+}
+
+// documentService is a service node together with the configuration it produced
+type documentService struct {
+	node *yaml.Node
+	cfg  ServiceConfig
+}
+
+// parseDocument parses the raw configuration file and associates each
+// service node with its loaded configuration
+func parseDocument(data []byte, services []ServiceConfig) (*document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file must contain a mapping")
+	}
+
+	doc := &document{root: &root, services: make(map[string]documentService)}
+	servicesNode := doc.servicesNode()
+	if servicesNode == nil || servicesNode.Kind != yaml.SequenceNode {
+		return doc, nil
+	}
+
+	for i, node := range servicesNode.Content {
+		if i < len(services) {
+			doc.services[services[i].Name] = documentService{node: node, cfg: services[i]}
+		}
+	}
+	return doc, nil
+}
+
+// servicesNode returns the value node of the top-level services key
+func (d *document) servicesNode() *yaml.Node {
+	mapping := d.root.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "services" {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setServices replaces the services node. Unchanged services keep their
+// original node; changed services are re-encoded with placeholders and
+// comments carried over from their original node where values still match.
+func (d *document) setServices(services []ServiceConfig) error {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if len(services) == 0 {
+		seq.Style = yaml.FlowStyle
+	}
+
+	newServices := make(map[string]documentService, len(services))
+	for _, svc := range services {
+		orig, exists := d.services[svc.Name]
+		if exists && reflect.DeepEqual(orig.cfg, svc) {
+			seq.Content = append(seq.Content, orig.node)
+			newServices[svc.Name] = orig
+			continue
+		}
+
+		var node yaml.Node
+		if err := node.Encode(svc); err != nil {
+			return fmt.Errorf("failed to encode service %s: %w", svc.Name, err)
+		}
+		if exists {
+			preserveSource(&node, orig.node)
+		}
+		seq.Content = append(seq.Content, &node)
+		newServices[svc.Name] = documentService{node: &node, cfg: svc}
+	}
+
+	mapping := d.root.Content[0]
+	if existing := d.servicesNode(); existing != nil {
+		seq.HeadComment = existing.HeadComment
+		seq.LineComment = existing.LineComment
+		seq.FootComment = existing.FootComment
+		*existing = *seq
+	} else {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "services"}
+		mapping.Content = append(mapping.Content, key, seq)
+	}
+
+	d.services = newServices
+	return nil
+}
+
+// marshal renders the document
+func (d *document) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// preserveSource copies comments from orig to node and restores original
+// scalar values, such as ${ENV} placeholders, wherever they still evaluate
+// to the newly encoded value
+func preserveSource(node, orig *yaml.Node) {
+	if node.Kind != orig.Kind {
+		return
+	}
+
+	node.HeadComment = orig.HeadComment
+	node.LineComment = orig.LineComment
+	node.FootComment = orig.FootComment
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if scalarEquivalent(orig.Value, node.Value) {
+			node.Value = orig.Value
+			node.Style = orig.Style
+			node.Tag = orig.Tag
+		}
+	case yaml.SequenceNode:
+		for i := 0; i < len(node.Content) && i < len(orig.Content); i++ {
+			preserveSource(node.Content[i], orig.Content[i])
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			for j := 0; j+1 < len(orig.Content); j += 2 {
+				if node.Content[i].Value == orig.Content[j].Value {
+					preserveSource(node.Content[i], orig.Content[j])
+					preserveSource(node.Content[i+1], orig.Content[j+1])
+					break
+				}
+			}
+		}
+	}
+}
+
+// scalarEquivalent reports whether an original scalar evaluates to the
+// newly encoded value after environment expansion
+func scalarEquivalent(orig, encoded string) bool {
+	return os.ExpandEnv(orig) == encoded
+}
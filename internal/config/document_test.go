@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `# Global settings
+authKey: ${TEST_AUTH_KEY} # from the environment
+stateDir: /data/tsnet
+
+services:
+  # Dashboards
+  - name: grafana
+    backend: http://${TEST_GRAFANA_HOST}:3000 # main instance
+    paths:
+      - /api
+  - name: wiki
+    backend: http://wiki:80
+`
+
+func TestSavePreservesDocument(t *testing.T) {
+	t.Setenv("TEST_AUTH_KEY", "tskey-secret")
+	t.Setenv("TEST_GRAFANA_HOST", "grafana")
+
+	cfg, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	// Change one field of the first service and add a new service
+	cfg.Services[0].StripPrefix = true
+	cfg.Services = append(cfg.Services, ServiceConfig{Name: "new", Backend: "http://new:8080"})
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(data)
+
+	for _, want := range []string{
+		"# Global settings",
+		"authKey: ${TEST_AUTH_KEY} # from the environment",
+		"# Dashboards",
+		"backend: http://${TEST_GRAFANA_HOST}:3000 # main instance",
+		"stripPrefix: true",
+		"name: new",
+	} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config is missing %q:\n%s", want, saved)
+		}
+	}
+	if strings.Contains(saved, "tskey-secret") {
+		t.Errorf("saved config contains the expanded auth key:\n%s", saved)
+	}
+
+	// The saved file loads back to the same services
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(reloaded.Services) != 3 {
+		t.Fatalf("reloaded %d services, want 3", len(reloaded.Services))
+	}
+	if !reflect.DeepEqual(reloaded.Services[:2], cfg.Services[:2]) {
+		t.Errorf("reloaded services differ:\ngot  %+v\nwant %+v", reloaded.Services[:2], cfg.Services[:2])
+	}
+	if svc := reloaded.Services[2]; svc.Name != "new" || svc.Backend != "http://new:8080" {
+		t.Errorf("reloaded new service = %+v", svc)
+	}
+}
+
+func TestSaveKeepsUnchangedServices(t *testing.T) {
+	t.Setenv("TEST_AUTH_KEY", "tskey-secret")
+	t.Setenv("TEST_GRAFANA_HOST", "grafana")
+
+	cfg, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Defaults applied by validation must not leak into untouched services
+	if strings.Contains(string(data), "mode:") {
+		t.Errorf("unchanged services were re-encoded:\n%s", data)
+	}
+}
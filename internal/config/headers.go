@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// HeaderTemplateFields are the values header templates may use, as in
+// {{.ClientIP}}
+var HeaderTemplateFields = []string{"ClientIP", "UserLogin", "NodeName", "RequestID"}
+
+// ParseHeaderTemplate parses a header value, rejecting fields not listed in
+// HeaderTemplateFields
+func ParseHeaderTemplate(name, value string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := make(map[string]string, len(HeaderTemplateFields))
+	for _, field := range HeaderTemplateFields {
+		sample[field] = ""
+	}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// validateHeaderRules checks header names and value templates
+func validateHeaderRules(rules HeaderRules) error {
+	for _, values := range []map[string]string{rules.Set, rules.Add} {
+		for name, value := range values {
+			if !validHeaderName(name) {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+			if _, err := ParseHeaderTemplate(name, value); err != nil {
+				return fmt.Errorf("header %s: %w", name, err)
+			}
+		}
+	}
+	for _, name := range rules.Remove {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// History keeps a rolling set of configuration file revisions on disk
+type History struct {
+	dir string
+	max int
+	mu  sync.Mutex
+}
+
+// Revision describes a stored configuration revision
+type Revision struct {
+	Number int       `json:"revision"`
+	Time   time.Time `json:"time"`
+	Size   int64     `json:"size"`
+}
+
+const revisionPrefix = "rev-"
+
+// NewHistory creates a history that keeps the last max revisions in dir
+func NewHistory(dir string, max int) *History {
+	return &History{dir: dir, max: max}
+}
+
+// Record stores data as a new revision unless it matches the latest one,
+// pruning revisions beyond the configured maximum. It returns the number of
+// the latest revision.
+func (h *History) Record(data []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	revisions, err := h.list()
+	if err != nil {
+		return 0, err
+	}
+
+	next := 1
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		prev, err := os.ReadFile(h.path(latest.Number))
+		if err == nil && bytes.Equal(prev, data) {
+			return latest.Number, nil
+		}
+		next = latest.Number + 1
+	}
+
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return 0, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err := WriteFile(h.path(next), data, 0600); err != nil {
+		return 0, err
+	}
+
+	// Prune the oldest revisions
+	revisions = append(revisions, Revision{Number: next})
+	for len(revisions) > h.max {
+		if err := os.Remove(h.path(revisions[0].Number)); err != nil && !os.IsNotExist(err) {
+			return next, fmt.Errorf("failed to prune revision %d: %w", revisions[0].Number, err)
+		}
+		revisions = revisions[1:]
+	}
+
+	return next, nil
+}
+
+// List returns the stored revisions, oldest first
+func (h *History) List() ([]Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.list()
+}
+
+// Get returns the content of a revision
+func (h *History) Get(rev int) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := os.ReadFile(h.path(rev))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("revision %d not found", rev)
+	}
+	return data, err
+}
+
+func (h *History) list() ([]Revision, error) {
+	entries, err := os.ReadDir(h.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	revisions := make([]Revision, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, revisionPrefix) || !strings.HasSuffix(name, ".yaml") {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, revisionPrefix), ".yaml"))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, Revision{Number: number, Time: info.ModTime(), Size: info.Size()})
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	return revisions, nil
+}
+
+func (h *History) path(rev int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%s%06d.yaml", revisionPrefix, rev))
+}
@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestHistoryRecord(t *testing.T) {
+	h := NewHistory(t.TempDir(), 3)
+
+	for i, data := range []string{"a", "b", "b", "c", "d"} {
+		if _, err := h.Record([]byte(data)); err != nil {
+			t.Fatalf("Record %d: %v", i, err)
+		}
+	}
+
+	// The duplicate "b" is not stored and "a" is pruned
+	revisions, err := h.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var numbers []int
+	for _, rev := range revisions {
+		numbers = append(numbers, rev.Number)
+	}
+	if len(numbers) != 3 || numbers[0] != 2 || numbers[2] != 4 {
+		t.Fatalf("revisions = %v, want [2 3 4]", numbers)
+	}
+
+	data, err := h.Get(2)
+	if err != nil || string(data) != "b" {
+		t.Errorf("Get(2) = %q, %v, want %q", data, err, "b")
+	}
+	if _, err := h.Get(1); err == nil {
+		t.Error("Get(1) of a pruned revision succeeded")
+	}
+}
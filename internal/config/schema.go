@@ -4,23 +4,291 @@ import "time"
 
 // Config represents the main configuration structure
 type Config struct {
-	Services      []ServiceConfig `yaml:"services"`
-	AuthKey       string          `yaml:"authKey"`
-	APIKey        string          `yaml:"apiKey"`        // Tailscale API key for device deletion
-	Tailnet       string          `yaml:"tailnet"`       // Tailnet name (e.g., example.com)
-	StateDir      string          `yaml:"stateDir"`
-	ManagementUI  ManagementUI    `yaml:"managementUI"`
-	Metrics       MetricsConfig   `yaml:"metrics"`
+	Services     []ServiceConfig `yaml:"services"`
+	AuthKey      string          `yaml:"authKey"`
+	APIKey       string          `yaml:"apiKey"`  // Tailscale API key for device deletion
+	Tailnet      string          `yaml:"tailnet"` // Tailnet name (e.g., example.com)
+	StateDir     string          `yaml:"stateDir"`
+	HistorySize  int             `yaml:"historySize"` // Config revisions kept in stateDir/config-history
+	ManagementUI ManagementUI    `yaml:"managementUI"`
+	Metrics      MetricsConfig   `yaml:"metrics"`
+	Groups       Groups          `yaml:"groups,omitempty"` // Named lists of login names for access rules
+
+	doc *document // Source document, set by Load
 }
 
+// Load balancing strategies
+const (
+	LoadBalancingRoundRobin       = "round-robin"
+	LoadBalancingLeastConnections = "least-connections"
+	LoadBalancingRandomTwoChoices = "random-two-choices"
+	LoadBalancingWeighted         = "weighted"
+)
+
+// Service modes
+const (
+	ModeHTTP = "http" // HTTP reverse proxy on ports 80 and 443
+	ModeTCP  = "tcp"  // Raw TCP forwarding on the configured ports
+	ModeUDP  = "udp"  // UDP datagram forwarding on the configured ports
+)
+
 // ServiceConfig represents a single service configuration
 type ServiceConfig struct {
-	Name        string            `yaml:"name"`
-	Backend     string            `yaml:"backend"`
-	Paths       []string          `yaml:"paths"`
-	StripPrefix bool              `yaml:"stripPrefix"`
-	HealthCheck HealthCheckConfig `yaml:"healthCheck"`
-	TLS         TLSConfig         `yaml:"tls"`
+	Name            string                `yaml:"name"`
+	Mode            string                `yaml:"mode,omitempty"`
+	Ports           []int                 `yaml:"ports,omitempty"`       // Tailnet ports for tcp and udp modes
+	Listeners       []ListenerConfig      `yaml:"listeners,omitempty"`   // Replaces the default listeners of the mode
+	IdleTimeout     time.Duration         `yaml:"idleTimeout,omitempty"` // Close tcp connections and udp sessions idle this long
+	Backend         string                `yaml:"backend,omitempty"`
+	Backends        []BackendConfig       `yaml:"backends,omitempty"`
+	LoadBalancing   string                `yaml:"loadBalancing,omitempty"`
+	Paths           []string              `yaml:"paths"`
+	Routes          []RouteConfig         `yaml:"routes,omitempty"` // Checked before paths, the most specific match wins
+	StripPrefix     bool                  `yaml:"stripPrefix"`
+	Rewrites        []RewriteRule         `yaml:"rewrites,omitempty"` // Applied to requests that match no route
+	ResponseRewrite ResponseRewriteConfig `yaml:"responseRewrite,omitempty"`
+	HostHeader      HostHeaderConfig      `yaml:"hostHeader,omitempty"`
+	TrustedProxies  []string              `yaml:"trustedProxies,omitempty"`  // IPs or CIDRs whose X-Forwarded-* and Forwarded headers are kept
+	RequestHeaders  HeaderRules           `yaml:"requestHeaders,omitempty"`  // Applied to requests sent to backends
+	ResponseHeaders HeaderRules           `yaml:"responseHeaders,omitempty"` // Applied to responses sent to clients
+	IdentityHeaders bool                  `yaml:"identityHeaders,omitempty"` // Add Tailscale-User-* headers
+	Access          AccessConfig          `yaml:"access,omitempty"`
+	HTTPRedirect    HTTPRedirectConfig    `yaml:"httpRedirect,omitempty"`
+	HSTS            HSTSConfig            `yaml:"hsts,omitempty"`
+	Funnel          FunnelConfig          `yaml:"funnel,omitempty"`
+	HealthCheck     HealthCheckConfig     `yaml:"healthCheck"`
+	TLS             TLSConfig             `yaml:"tls"`
+}
+
+// FunnelConfig exposes a service to the public internet with Tailscale Funnel
+type FunnelConfig struct {
+	Enabled bool             `yaml:"enabled" json:"enabled"`
+	Port    int              `yaml:"port,omitempty" json:"port"`   // 443, 8443 or 10000
+	Paths   []string         `yaml:"paths,omitempty" json:"paths"` // Path prefixes reachable through Funnel, empty allows all
+	Auth    FunnelAuthConfig `yaml:"auth,omitempty" json:"auth"`
+}
+
+// FunnelAuthConfig lists the credentials accepted on Funnel requests. When
+// any are configured, Funnel requests must present one of them.
+type FunnelAuthConfig struct {
+	Users  map[string]string `yaml:"users,omitempty" json:"users"`   // Basic auth user names and passwords
+	Tokens []string          `yaml:"tokens,omitempty" json:"tokens"` // Bearer tokens
+}
+
+// Required reports whether Funnel requests must authenticate
+func (a FunnelAuthConfig) Required() bool {
+	return len(a.Users) > 0 || len(a.Tokens) > 0
+}
+
+// HTTP redirect modes
+const (
+	HTTPRedirectServe    = "serve"    // Serve plain HTTP like HTTPS (default)
+	HTTPRedirectRedirect = "redirect" // Redirect plain HTTP to HTTPS
+	HTTPRedirectDisabled = "disabled" // Do not listen for plain HTTP
+)
+
+// Host header modes
+const (
+	HostHeaderPreserve = "preserve" // Forward the Host the client used (default)
+	HostHeaderBackend  = "backend"  // Use the host of the backend URL
+	HostHeaderCustom   = "custom"   // Use a fixed value
+)
+
+// HostHeaderConfig controls the Host header sent to HTTP backends
+type HostHeaderConfig struct {
+	Mode  string `yaml:"mode,omitempty" json:"mode"`
+	Value string `yaml:"value,omitempty" json:"value,omitempty"` // Host for custom mode
+}
+
+// HTTPRedirectConfig controls plain HTTP listeners that use the service backends
+type HTTPRedirectConfig struct {
+	Mode string `yaml:"mode,omitempty" json:"mode"`
+	Code int    `yaml:"code,omitempty" json:"code"` // 301 or 308
+}
+
+// HSTSConfig controls the Strict-Transport-Security header on HTTPS responses
+type HSTSConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	MaxAge  int  `yaml:"maxAge,omitempty" json:"maxAge"` // Seconds
+}
+
+// Listener protocols
+const (
+	ListenerHTTP  = "http"  // Plain HTTP
+	ListenerHTTPS = "https" // HTTP with Tailscale certificates
+	ListenerTCP   = "tcp"   // Raw TCP
+	ListenerTLS   = "tls"   // TCP with TLS terminated using Tailscale certificates
+	ListenerUDP   = "udp"   // UDP datagrams, only used for ports in udp mode
+)
+
+// ListenerConfig represents a tailnet port a service listens on
+type ListenerConfig struct {
+	Port     int    `yaml:"port" json:"port"`
+	Protocol string `yaml:"protocol" json:"protocol"`
+	Backend  string `yaml:"backend,omitempty" json:"backend,omitempty"` // Sends this listener's traffic here instead of to the service backends
+}
+
+// IsHTTP reports whether the listener serves HTTP requests
+func (l ListenerConfig) IsHTTP() bool {
+	return l.Protocol == ListenerHTTP || l.Protocol == ListenerHTTPS
+}
+
+// ListenerList returns the listeners of the service, deriving the defaults of
+// its mode when no listeners are configured and leaving out plain HTTP
+// listeners when httpRedirect is disabled
+func (s ServiceConfig) ListenerList() []ListenerConfig {
+	if len(s.Listeners) > 0 {
+		if s.HTTPRedirect.Mode != HTTPRedirectDisabled {
+			return s.Listeners
+		}
+		listeners := make([]ListenerConfig, 0, len(s.Listeners))
+		for _, l := range s.Listeners {
+			if l.Protocol != ListenerHTTP || l.Backend != "" {
+				listeners = append(listeners, l)
+			}
+		}
+		return listeners
+	}
+
+	if s.IsL4() {
+		listeners := make([]ListenerConfig, 0, len(s.Ports))
+		for _, port := range s.Ports {
+			listeners = append(listeners, ListenerConfig{Port: port, Protocol: s.Mode})
+		}
+		return listeners
+	}
+
+	if s.HTTPRedirect.Mode == HTTPRedirectDisabled {
+		return []ListenerConfig{{Port: 443, Protocol: ListenerHTTPS}}
+	}
+	return []ListenerConfig{
+		{Port: 443, Protocol: ListenerHTTPS},
+		{Port: 80, Protocol: ListenerHTTP},
+	}
+}
+
+// IsL4 reports whether the service forwards raw tcp or udp traffic
+func (s ServiceConfig) IsL4() bool {
+	return s.Mode == ModeTCP || s.Mode == ModeUDP
+}
+
+// RouteConfig sends requests matching a route to its own upstream
+type RouteConfig struct {
+	Name          string          `yaml:"name,omitempty" json:"name"`
+	Match         RouteMatch      `yaml:"match" json:"match"`
+	Backend       string          `yaml:"backend,omitempty" json:"backend,omitempty"`
+	Backends      []BackendConfig `yaml:"backends,omitempty" json:"backends,omitempty"`
+	LoadBalancing string          `yaml:"loadBalancing,omitempty" json:"loadBalancing,omitempty"`
+	StripPrefix   bool            `yaml:"stripPrefix,omitempty" json:"stripPrefix"` // Remove pathPrefix before forwarding
+	Rewrites      []RewriteRule   `yaml:"rewrites,omitempty" json:"rewrites,omitempty"`
+}
+
+// BackendList returns the backends of the route
+func (r RouteConfig) BackendList() []BackendConfig {
+	if len(r.Backends) > 0 {
+		return r.Backends
+	}
+	if r.Backend != "" {
+		return []BackendConfig{{URL: r.Backend, Weight: 1}}
+	}
+	return nil
+}
+
+// RewriteRule changes the request path before it is forwarded, or redirects
+// the client. Rules apply in order to the path left after stripPrefix; each
+// sets exactly one of Replace, AddPrefix and Redirect.
+type RewriteRule struct {
+	Match     string `yaml:"match,omitempty" json:"match,omitempty"`         // Regular expression, empty matches every path
+	Replace   string `yaml:"replace,omitempty" json:"replace,omitempty"`     // Replaces the matched text, may use $1 or ${name}
+	AddPrefix string `yaml:"addPrefix,omitempty" json:"addPrefix,omitempty"` // Prepended to the path
+	Redirect  string `yaml:"redirect,omitempty" json:"redirect,omitempty"`   // Target path or URL, may use $1 or ${name}
+	Code      int    `yaml:"code,omitempty" json:"code,omitempty"`           // Redirect status: 301, 302, 307 or 308
+}
+
+// ResponseRewriteConfig rewrites backend responses so that apps served below
+// a stripped prefix or behind the public host name keep working
+type ResponseRewriteConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`     // Rewrite Location, Content-Location and Set-Cookie
+	Body    bool `yaml:"body,omitempty" json:"body"` // Also rewrite links in HTML and CSS bodies
+}
+
+// HeaderRules modifies HTTP headers: Remove is applied first, then Set and
+// Add. Values are templates that may use the HeaderTemplateFields.
+type HeaderRules struct {
+	Set    map[string]string `yaml:"set,omitempty" json:"set,omitempty"`
+	Add    map[string]string `yaml:"add,omitempty" json:"add,omitempty"`
+	Remove []string          `yaml:"remove,omitempty" json:"remove,omitempty"`
+}
+
+// IsEmpty reports whether the rules change nothing
+func (h HeaderRules) IsEmpty() bool {
+	return len(h.Set) == 0 && len(h.Add) == 0 && len(h.Remove) == 0
+}
+
+// RouteMatch lists the conditions a request must meet to use a route. At
+// most one path condition may be set; a route without one matches any path.
+type RouteMatch struct {
+	PathPrefix string            `yaml:"pathPrefix,omitempty" json:"pathPrefix,omitempty"`
+	Path       string            `yaml:"path,omitempty" json:"path,omitempty"`           // Exact path
+	PathRegex  string            `yaml:"pathRegex,omitempty" json:"pathRegex,omitempty"` // Regular expression matched against the whole path
+	Methods    []string          `yaml:"methods,omitempty" json:"methods,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"` // Exact values, or "" to require presence
+	Host       string            `yaml:"host,omitempty" json:"host,omitempty"`       // Host name or "*.suffix"
+}
+
+// AccessConfig restricts which tailnet identities may use a service. Rules
+// of the longest matching path prefix replace the service-wide rules.
+type AccessConfig struct {
+	Allow AccessMatch        `yaml:"allow,omitempty" json:"allow"`
+	Deny  AccessMatch        `yaml:"deny,omitempty" json:"deny"`
+	Paths []PathAccessConfig `yaml:"paths,omitempty" json:"paths"`
+}
+
+// PathAccessConfig represents access rules scoped to a path prefix
+type PathAccessConfig struct {
+	Prefix string      `yaml:"prefix" json:"prefix"`
+	Allow  AccessMatch `yaml:"allow,omitempty" json:"allow"`
+	Deny   AccessMatch `yaml:"deny,omitempty" json:"deny"`
+}
+
+// AccessMatch matches callers by their Tailscale identity. A caller matches
+// when any of the listed users, groups, tags or capabilities apply to it.
+type AccessMatch struct {
+	Users        []string `yaml:"users,omitempty" json:"users"`               // Login names, "*@domain" or "*"
+	Groups       []string `yaml:"groups,omitempty" json:"groups"`             // Names of groups defined in the top-level groups
+	Tags         []string `yaml:"tags,omitempty" json:"tags"`                 // Node tags, e.g. tag:ci
+	Capabilities []string `yaml:"capabilities,omitempty" json:"capabilities"` // Peer capabilities from tailnet grants
+}
+
+// IsEmpty reports whether the match lists no identities
+func (m AccessMatch) IsEmpty() bool {
+	return len(m.Users) == 0 && len(m.Groups) == 0 && len(m.Tags) == 0 && len(m.Capabilities) == 0
+}
+
+// Groups maps group names to the login names of their members
+type Groups map[string][]string
+
+// Enabled reports whether any access rules are configured
+func (a AccessConfig) Enabled() bool {
+	return !a.Allow.IsEmpty() || !a.Deny.IsEmpty() || len(a.Paths) > 0
+}
+
+// BackendConfig represents a single upstream of a service
+type BackendConfig struct {
+	URL    string `yaml:"url" json:"url"`
+	Weight int    `yaml:"weight,omitempty" json:"weight"` // Only used by the weighted strategy
+}
+
+// BackendList returns the configured backends, treating a single Backend
+// URL as a one-element list
+func (s ServiceConfig) BackendList() []BackendConfig {
+	if len(s.Backends) > 0 {
+		return s.Backends
+	}
+	if s.Backend != "" {
+		return []BackendConfig{{URL: s.Backend, Weight: 1}}
+	}
+	return nil
 }
 
 // HealthCheckConfig represents health check settings
@@ -30,6 +298,8 @@ type HealthCheckConfig struct {
 	Interval           time.Duration `yaml:"interval"`
 	Timeout            time.Duration `yaml:"timeout"`
 	UnhealthyThreshold int           `yaml:"unhealthyThreshold"`
+	HealthyThreshold   int           `yaml:"healthyThreshold"`
+	ExpectBody         string        `yaml:"expectBody,omitempty"` // Text the response body must contain
 }
 
 // TLSConfig represents TLS settings for backend connections
@@ -40,9 +310,11 @@ type TLSConfig struct {
 
 // ManagementUI represents the management UI configuration
 type ManagementUI struct {
-	Enabled  bool   `yaml:"enabled"`
-	Hostname string `yaml:"hostname"`
-	Port     int    `yaml:"port"`
+	Enabled  bool        `yaml:"enabled"`
+	Hostname string      `yaml:"hostname"`
+	Port     int         `yaml:"port"`
+	Admins   AccessMatch `yaml:"admins,omitempty"`  // Callers allowed to change services
+	Viewers  AccessMatch `yaml:"viewers,omitempty"` // Callers allowed to view status
 }
 
 // MetricsConfig represents metrics configuration
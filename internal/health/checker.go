@@ -2,20 +2,31 @@ package health
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
 	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+	"github.com/NathanBhanji/tsnet-proxy/internal/metrics"
 )
 
+// maxCheckBodySize is how much of a response body is searched for expectBody
+const maxCheckBodySize = 64 * 1024
+
 // Checker performs periodic health checks on services
 type Checker struct {
-	manager *manager.Manager
-	client  *http.Client
-	mu      sync.RWMutex
-	stopCh  chan struct{}
+	manager     *manager.Manager
+	client      *http.Client
+	mu          sync.Mutex
+	loops       map[string]context.CancelFunc
+	histories   map[string]*history // By service name, guarded by mu
+	unsubscribe func()
 }
 
 // NewChecker creates a new health checker instance
@@ -32,102 +43,233 @@ func NewChecker(mgr *manager.Manager) *Checker {
 				MaxIdleConnsPerHost: 10,
 			},
 		},
-		stopCh: make(chan struct{}),
+		loops:     make(map[string]context.CancelFunc),
+		histories: make(map[string]*history),
 	}
 }
 
-// Start begins health checking for all services
+// Start begins health checking for all current services and follows
+// manager lifecycle events to start and stop checks for services added or
+// removed at runtime
 func (c *Checker) Start(ctx context.Context) {
-	services := c.manager.GetAllServices()
+	// Subscribe before listing services so no addition is missed
+	events, unsubscribe := c.manager.Subscribe()
 
+	c.mu.Lock()
+	c.unsubscribe = unsubscribe
+	c.mu.Unlock()
+
+	services := c.manager.GetAllServices()
 	for _, svc := range services {
-		if svc.Config.HealthCheck.Enabled {
-			go c.runHealthCheck(ctx, svc)
-		}
+		c.startLoop(ctx, svc)
 	}
 
+	go c.watchEvents(ctx, events)
+
 	log.Printf("Health checker started for %d services", len(services))
 }
 
 // Stop stops all health checking
 func (c *Checker) Stop() {
-	close(c.stopCh)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+	for name, cancel := range c.loops {
+		cancel()
+		delete(c.loops, name)
+	}
 	log.Printf("Health checker stopped")
 }
 
-// runHealthCheck performs periodic health checks for a single service
+// watchEvents starts and stops check loops as services come and go
+func (c *Checker) watchEvents(ctx context.Context, events <-chan manager.Event) {
+	for event := range events {
+		switch event.Type {
+		case manager.EventServiceAdded, manager.EventConfigUpdated:
+			c.startLoop(ctx, event.Service)
+		case manager.EventServiceRemoved:
+			c.stopLoop(event.Name)
+			c.mu.Lock()
+			delete(c.histories, event.Name)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// startLoop starts the check loop for a service, replacing any existing one
+func (c *Checker) startLoop(ctx context.Context, svc *manager.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, exists := c.loops[svc.Config.Name]; exists {
+		cancel()
+		delete(c.loops, svc.Config.Name)
+	}
+
+	if !svc.Config.HealthCheck.Enabled {
+		return
+	}
+
+	if _, exists := c.histories[svc.Config.Name]; !exists {
+		c.histories[svc.Config.Name] = &history{}
+	}
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	c.loops[svc.Config.Name] = cancel
+	go c.runHealthCheck(loopCtx, svc)
+}
+
+// stopLoop stops the check loop for a service if one is running
+func (c *Checker) stopLoop(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, exists := c.loops[name]; exists {
+		cancel()
+		delete(c.loops, name)
+	}
+}
+
+// runHealthCheck performs periodic health checks for every backend of a service
 func (c *Checker) runHealthCheck(ctx context.Context, svc *manager.Service) {
 	cfg := svc.Config.HealthCheck
 	ticker := time.NewTicker(cfg.Interval)
 	defer ticker.Stop()
 
-	failureCount := 0
-
-	log.Printf("Starting health checks for service %s (interval: %s, path: %s)",
-		svc.Config.Name, cfg.Interval, cfg.Path)
+	log.Printf("Starting health checks for service %s (interval: %s, path: %s, backends: %d)",
+		svc.Config.Name, cfg.Interval, cfg.Path, len(svc.Backends()))
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("Health checker for service %s stopped (context done)", svc.Config.Name)
-			return
-		case <-c.stopCh:
 			log.Printf("Health checker for service %s stopped", svc.Config.Name)
 			return
 		case <-ticker.C:
-			healthy := c.performCheck(svc)
-
-			if !healthy {
-				failureCount++
-				log.Printf("Health check failed for service %s (failures: %d/%d)",
-					svc.Config.Name, failureCount, cfg.UnhealthyThreshold)
-
-				if failureCount >= cfg.UnhealthyThreshold {
-					if svc.IsHealthy() {
-						log.Printf("Service %s marked UNHEALTHY after %d consecutive failures",
-							svc.Config.Name, failureCount)
-						svc.SetHealthy(false)
-					}
-				}
-			} else {
-				if failureCount > 0 || !svc.IsHealthy() {
-					log.Printf("Service %s marked HEALTHY", svc.Config.Name)
-				}
-				failureCount = 0
-				svc.SetHealthy(true)
+			for _, backend := range svc.Backends() {
+				c.checkBackend(svc, backend)
 			}
 		}
 	}
 }
 
-// performCheck executes a single health check
-func (c *Checker) performCheck(svc *manager.Service) bool {
+// checkBackend runs a single health check against a backend and records the result
+func (c *Checker) checkBackend(svc *manager.Service, backend *manager.Backend) {
+	cfg := svc.Config.HealthCheck
+	wasHealthy := svc.IsHealthy()
+
+	start := time.Now()
+	err := c.performCheck(svc, backend)
+	latency := time.Since(start)
+	changed := svc.RecordCheck(backend, err)
+
+	result := classify(err)
+	failures := backend.Health().ConsecutiveFailures
+	metrics.RecordHealthCheck(svc.Config.Name, backend.URL.String(), result, latency, failures)
+	entry := CheckResult{
+		Time:      start,
+		Backend:   backend.URL.String(),
+		Result:    result,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	// A check still in flight when its service is removed is not recorded
+	if h := c.history(svc.Config.Name); h != nil {
+		h.add(entry)
+	}
+	if err != nil {
+		log.Printf("Health check failed for service %s backend %s: %v (failures: %d/%d)",
+			svc.Config.Name, backend.URL, err, failures, cfg.UnhealthyThreshold)
+	}
+
+	if !changed {
+		return
+	}
+
+	if backend.IsHealthy() {
+		log.Printf("Service %s backend %s marked HEALTHY", svc.Config.Name, backend.URL)
+	} else {
+		log.Printf("Service %s backend %s marked UNHEALTHY after %d consecutive failures",
+			svc.Config.Name, backend.URL, backend.Health().ConsecutiveFailures)
+	}
+
+	if isHealthy := svc.IsHealthy(); isHealthy != wasHealthy {
+		if isHealthy {
+			log.Printf("Service %s marked HEALTHY", svc.Config.Name)
+		} else {
+			log.Printf("Service %s marked UNHEALTHY: all backends are down", svc.Config.Name)
+		}
+	}
+}
+
+// performCheck executes a single health check against one backend
+func (c *Checker) performCheck(svc *manager.Service, backend *manager.Backend) error {
 	cfg := svc.Config.HealthCheck
-	healthURL := svc.Config.Backend + cfg.Path
+
+	// TCP backends are healthy when they accept connections
+	if svc.Config.Mode == config.ModeTCP {
+		conn, err := net.DialTimeout("tcp", backend.Address(svc.ForwardPort()), cfg.Timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	healthURL := backend.URL.String() + cfg.Path
 
 	checkCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(checkCtx, "GET", healthURL, nil)
 	if err != nil {
-		log.Printf("Failed to create health check request for %s: %v", svc.Config.Name, err)
-		return false
+		return fmt.Errorf("failed to create health check request: %w", err)
 	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		log.Printf("Health check error for %s: %v", svc.Config.Name, err)
-		return false
+		return err
 	}
 	defer resp.Body.Close()
 
 	// Consider 2xx and 3xx as healthy
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		return true
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return &checkError{result: ResultBadStatus, msg: fmt.Sprintf("unexpected status %d", resp.StatusCode)}
 	}
 
-	log.Printf("Health check for %s returned status %d", svc.Config.Name, resp.StatusCode)
-	return false
+	if cfg.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxCheckBodySize))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(body), cfg.ExpectBody) {
+			return &checkError{result: ResultBodyMismatch, msg: fmt.Sprintf("response body does not contain %q", cfg.ExpectBody)}
+		}
+	}
+	return nil
+}
+
+// history returns the check history of a service, or nil if the service is
+// not being checked
+func (c *Checker) history(name string) *history {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.histories[name]
+}
+
+// History returns the most recent check results of a service, oldest first
+func (c *Checker) History(name string) []CheckResult {
+	c.mu.Lock()
+	h, exists := c.histories[name]
+	c.mu.Unlock()
+
+	if !exists {
+		return []CheckResult{}
+	}
+	return h.list()
 }
 
 // GetServiceStatus returns the health status of a specific service
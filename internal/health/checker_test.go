@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+)
+
+func TestRemovedServiceHistory(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	svc, err := manager.NewService(config.ServiceConfig{
+		Name:    "app",
+		Mode:    config.ModeHTTP,
+		Backend: backend.URL,
+		HealthCheck: config.HealthCheckConfig{
+			Enabled:  true,
+			Path:     "/health",
+			Interval: time.Hour,
+			Timeout:  time.Second,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewChecker(nil)
+	c.startLoop(ctx, svc)
+	c.checkBackend(svc, svc.Backends()[0])
+	if got := c.History("app"); len(got) != 1 {
+		t.Fatalf("history has %d results, want 1", len(got))
+	}
+
+	// Remove the service the way watchEvents does, then finish a check that
+	// was still in flight
+	c.stopLoop("app")
+	c.mu.Lock()
+	delete(c.histories, "app")
+	c.mu.Unlock()
+	c.checkBackend(svc, svc.Backends()[0])
+
+	c.mu.Lock()
+	_, exists := c.histories["app"]
+	c.mu.Unlock()
+	if exists {
+		t.Error("check after removal recreated the service history")
+	}
+}
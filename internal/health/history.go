@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// historySize is the number of check results kept per service
+const historySize = 100
+
+// Check results
+const (
+	ResultHealthy           = "healthy"
+	ResultTimeout           = "timeout"
+	ResultConnectionRefused = "connection_refused"
+	ResultBadStatus         = "bad_status"
+	ResultBodyMismatch      = "body_mismatch"
+	ResultError             = "error" // Any other failure
+)
+
+// CheckResult is the outcome of a single health check
+type CheckResult struct {
+	Time      time.Time `json:"time"`
+	Backend   string    `json:"backend"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs float64   `json:"latencyMs"`
+}
+
+// history is a ring buffer of the most recent check results of a service
+type history struct {
+	mu      sync.Mutex
+	results [historySize]CheckResult
+	next    int
+	full    bool
+}
+
+// add records a result, overwriting the oldest once the buffer is full
+func (h *history) add(result CheckResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.results[h.next] = result
+	h.next = (h.next + 1) % historySize
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the recorded results, oldest first
+func (h *history) list() []CheckResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]CheckResult(nil), h.results[:h.next]...)
+	}
+	return append(append([]CheckResult(nil), h.results[h.next:]...), h.results[:h.next]...)
+}
+
+// checkError is a failed check with a known result
+type checkError struct {
+	result string
+	msg    string
+}
+
+func (e *checkError) Error() string {
+	return e.msg
+}
+
+// classify returns the result of a check that ended with err
+func classify(err error) string {
+	var ce *checkError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ResultHealthy
+	case errors.As(err, &ce):
+		return ce.result
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return ResultTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ResultConnectionRefused
+	default:
+		return ResultError
+	}
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	var h history
+	if got := h.list(); len(got) != 0 {
+		t.Fatalf("empty history has %d results", len(got))
+	}
+
+	for i := 0; i < historySize+5; i++ {
+		h.add(CheckResult{LatencyMs: float64(i)})
+	}
+
+	// The oldest results are overwritten and the rest are listed in order
+	got := h.list()
+	if len(got) != historySize {
+		t.Fatalf("history has %d results, want %d", len(got), historySize)
+	}
+	if got[0].LatencyMs != 5 || got[historySize-1].LatencyMs != historySize+4 {
+		t.Errorf("history spans %v to %v, want 5 to %d", got[0].LatencyMs, got[historySize-1].LatencyMs, historySize+4)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"success", nil, ResultHealthy},
+		{"bad status", &checkError{result: ResultBadStatus, msg: "status 503"}, ResultBadStatus},
+		{"wrapped body mismatch", fmt.Errorf("check: %w", &checkError{result: ResultBodyMismatch}), ResultBodyMismatch},
+		{"deadline", context.DeadlineExceeded, ResultTimeout},
+		{"refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ResultConnectionRefused},
+		{"other", errors.New("no such host"), ResultError},
+	}
+
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("%s: classify = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Timeout: 10 * time.Millisecond}
+	_, err := client.Get(srv.URL)
+	if got := classify(err); got != ResultTimeout {
+		t.Errorf("classify(%v) = %q, want %q", err, got, ResultTimeout)
+	}
+}
@@ -0,0 +1,202 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// Backend represents a single upstream of a service with its own reverse proxy
+type Backend struct {
+	URL     *url.URL
+	Weight  int
+	proxy   *httputil.ReverseProxy
+	healthy atomic.Bool
+	active  atomic.Int64
+
+	bytesSent     atomic.Int64 // Bytes forwarded to the backend
+	bytesReceived atomic.Int64 // Bytes forwarded from the backend
+
+	mu        sync.Mutex
+	failures  int
+	successes int
+	lastCheck time.Time
+	lastError string
+}
+
+// BackendHealth is a snapshot of a backend's health check state
+type BackendHealth struct {
+	Healthy              bool
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
+	LastCheck            time.Time
+	LastError            string
+}
+
+// newBackend creates a Backend for the given upstream configuration
+func newBackend(serviceName string, cfg config.BackendConfig, transport http.RoundTripper) (*Backend, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend URL %s: %w", cfg.URL, err)
+	}
+
+	weight := cfg.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+
+	b := &Backend{
+		URL:    target,
+		Weight: weight,
+	}
+	b.healthy.Store(true) // Assume healthy initially
+
+	// TCP and UDP backends are forwarded without a reverse proxy
+	if target.Scheme == "tcp" || target.Scheme == "udp" {
+		return b, nil
+	}
+
+	// Create reverse proxy
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	proxy.Transport = timedTransport{next: transport}
+
+	// Apply the header rules and response rewriting attached to the request
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		applyRequestHeaders(r)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if err := rewriteResponse(resp); err != nil {
+			return err
+		}
+		applyResponseHeaders(resp)
+		return nil
+	}
+
+	// Set up error handler
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Proxy error for service %s (backend %s): %v", serviceName, target, err)
+		setRequestError(r, classifyProxyError(err))
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}
+
+	b.proxy = proxy
+	return b, nil
+}
+
+// Address returns the host:port to dial for a TCP or UDP backend. Backends
+// without a port use the tailnet port the traffic arrived on.
+func (b *Backend) Address(port int) string {
+	if b.URL.Port() != "" {
+		return b.URL.Host
+	}
+	return net.JoinHostPort(b.URL.Hostname(), strconv.Itoa(port))
+}
+
+// BytesSent returns the number of bytes forwarded to the backend
+func (b *Backend) BytesSent() int64 {
+	return b.bytesSent.Load()
+}
+
+// BytesReceived returns the number of bytes forwarded from the backend
+func (b *Backend) BytesReceived() int64 {
+	return b.bytesReceived.Load()
+}
+
+// IsHealthy returns the current health status of the backend
+func (b *Backend) IsHealthy() bool {
+	return b.healthy.Load()
+}
+
+// SetHealthy updates the health status of the backend
+func (b *Backend) SetHealthy(healthy bool) {
+	b.healthy.Store(healthy)
+}
+
+// RecordCheck records the result of a health check against the backend.
+// The backend is marked unhealthy after unhealthyThreshold consecutive
+// failures and healthy again after healthyThreshold consecutive successes.
+// It returns true when the health status changed.
+func (b *Backend) RecordCheck(checkErr error, unhealthyThreshold, healthyThreshold int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastCheck = time.Now()
+
+	if checkErr != nil {
+		b.failures++
+		b.successes = 0
+		b.lastError = checkErr.Error()
+		if b.failures >= unhealthyThreshold {
+			return b.healthy.Swap(false)
+		}
+		return false
+	}
+
+	b.successes++
+	b.failures = 0
+	b.lastError = ""
+	if b.successes >= healthyThreshold {
+		return !b.healthy.Swap(true)
+	}
+	return false
+}
+
+// Health returns a snapshot of the backend's health check state
+func (b *Backend) Health() BackendHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BackendHealth{
+		Healthy:              b.IsHealthy(),
+		ConsecutiveFailures:  b.failures,
+		ConsecutiveSuccesses: b.successes,
+		LastCheck:            b.lastCheck,
+		LastError:            b.lastError,
+	}
+}
+
+// copyHealth copies the health check state of another backend
+func (b *Backend) copyHealth(from *Backend) {
+	health := from.Health()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.healthy.Store(health.Healthy)
+	b.failures = health.ConsecutiveFailures
+	b.successes = health.ConsecutiveSuccesses
+	b.lastCheck = health.LastCheck
+	b.lastError = health.LastError
+}
+
+// ActiveRequests returns the number of in-flight requests or open
+// connections to the backend
+func (b *Backend) ActiveRequests() int64 {
+	return b.active.Load()
+}
+
+// ServeHTTP proxies the request to the backend while tracking in-flight requests
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if b.proxy == nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	b.active.Add(1)
+	defer b.active.Add(-1)
+	b.proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// Balancer selects a backend for each request from the healthy backends
+type Balancer interface {
+	Next(backends []*Backend) *Backend
+}
+
+// NewBalancer returns the Balancer for the given load balancing strategy,
+// falling back to round-robin for unknown or empty strategies
+func NewBalancer(strategy string) Balancer {
+	switch strategy {
+	case config.LoadBalancingLeastConnections:
+		return &leastConnectionsBalancer{}
+	case config.LoadBalancingRandomTwoChoices:
+		return &randomTwoChoicesBalancer{}
+	case config.LoadBalancingWeighted:
+		return &weightedBalancer{current: make(map[*Backend]int)}
+	default:
+		return &roundRobinBalancer{}
+	}
+}
+
+// roundRobinBalancer cycles through backends in order
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Next(backends []*Backend) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+	n := b.next.Add(1) - 1
+	return backends[n%uint64(len(backends))]
+}
+
+// leastConnectionsBalancer picks the backend with the fewest in-flight requests
+type leastConnectionsBalancer struct{}
+
+func (b *leastConnectionsBalancer) Next(backends []*Backend) *Backend {
+	var best *Backend
+	for _, backend := range backends {
+		if best == nil || backend.ActiveRequests() < best.ActiveRequests() {
+			best = backend
+		}
+	}
+	return best
+}
+
+// randomTwoChoicesBalancer picks two backends at random and uses the less loaded one
+type randomTwoChoicesBalancer struct{}
+
+func (b *randomTwoChoicesBalancer) Next(backends []*Backend) *Backend {
+	switch len(backends) {
+	case 0:
+		return nil
+	case 1:
+		return backends[0]
+	}
+
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+
+	if backends[j].ActiveRequests() < backends[i].ActiveRequests() {
+		return backends[j]
+	}
+	return backends[i]
+}
+
+// weightedBalancer implements smooth weighted round-robin
+type weightedBalancer struct {
+	mu      sync.Mutex
+	current map[*Backend]int
+}
+
+func (b *weightedBalancer) Next(backends []*Backend) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *Backend
+	total := 0
+	for _, backend := range backends {
+		b.current[backend] += backend.Weight
+		total += backend.Weight
+		if best == nil || b.current[backend] > b.current[best] {
+			best = backend
+		}
+	}
+
+	if best != nil {
+		b.current[best] -= total
+	}
+	return best
+}
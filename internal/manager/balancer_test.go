@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// testBackends creates HTTP backends with the given weights
+func testBackends(t *testing.T, weights ...int) []*Backend {
+	t.Helper()
+	backends := make([]*Backend, len(weights))
+	for i, weight := range weights {
+		backend, err := newBackend("test", config.BackendConfig{URL: "http://backend-" + string(rune('a'+i)) + ":80", Weight: weight}, nil)
+		if err != nil {
+			t.Fatalf("newBackend: %v", err)
+		}
+		backends[i] = backend
+	}
+	return backends
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	backends := testBackends(t, 1, 1, 1)
+	b := NewBalancer(config.LoadBalancingRoundRobin)
+
+	for i := 0; i < 6; i++ {
+		if got := b.Next(backends); got != backends[i%3] {
+			t.Errorf("pick %d = %s, want %s", i, got.URL, backends[i%3].URL)
+		}
+	}
+	if got := b.Next(nil); got != nil {
+		t.Errorf("Next(nil) = %v, want nil", got)
+	}
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	backends := testBackends(t, 5, 1, 1)
+	b := NewBalancer(config.LoadBalancingWeighted)
+
+	// Smooth weighted round-robin interleaves the heavy backend instead of
+	// sending it five requests in a row
+	want := []int{0, 0, 1, 0, 2, 0, 0}
+	for i, idx := range want {
+		if got := b.Next(backends); got != backends[idx] {
+			t.Errorf("pick %d = %s, want %s", i, got.URL, backends[idx].URL)
+		}
+	}
+
+	counts := make(map[*Backend]int)
+	for i := 0; i < 700; i++ {
+		counts[b.Next(backends)]++
+	}
+	for i, weight := range []int{5, 1, 1} {
+		if counts[backends[i]] != weight*100 {
+			t.Errorf("backend %d picked %d times, want %d", i, counts[backends[i]], weight*100)
+		}
+	}
+}
+
+func TestLeastConnectionsBalancer(t *testing.T) {
+	backends := testBackends(t, 1, 1, 1)
+	backends[0].active.Store(3)
+	backends[1].active.Store(1)
+	backends[2].active.Store(2)
+
+	if got := NewBalancer(config.LoadBalancingLeastConnections).Next(backends); got != backends[1] {
+		t.Errorf("Next = %s, want %s", got.URL, backends[1].URL)
+	}
+}
+
+func TestRandomTwoChoicesBalancer(t *testing.T) {
+	backends := testBackends(t, 1, 1, 1)
+	backends[0].active.Store(10)
+	b := NewBalancer(config.LoadBalancingRandomTwoChoices)
+
+	// The busy backend loses every comparison, so it is never picked
+	for i := 0; i < 100; i++ {
+		if got := b.Next(backends); got == backends[0] {
+			t.Fatalf("pick %d chose the busiest backend", i)
+		}
+	}
+
+	if got := b.Next(backends[:1]); got != backends[0] {
+		t.Errorf("single backend: Next = %v, want %s", got, backends[0].URL)
+	}
+}
+
+func TestNextHealthySkipsUnhealthy(t *testing.T) {
+	backends := testBackends(t, 1, 1)
+	backends[0].healthy.Store(false)
+	b := NewBalancer(config.LoadBalancingRoundRobin)
+
+	for i := 0; i < 3; i++ {
+		if got := nextHealthy(backends, b); got != backends[1] {
+			t.Errorf("pick %d = %v, want %s", i, got, backends[1].URL)
+		}
+	}
+
+	backends[1].healthy.Store(false)
+	if got := nextHealthy(backends, b); got != nil {
+		t.Errorf("all unhealthy: nextHealthy = %s, want nil", got.URL)
+	}
+}
@@ -0,0 +1,119 @@
+package manager
+
+import "sync"
+
+// EventType identifies the kind of lifecycle event emitted by the Manager
+type EventType string
+
+const (
+	// EventServiceAdded is emitted after a service has been started
+	EventServiceAdded EventType = "ServiceAdded"
+	// EventServiceRemoved is emitted after a service has been stopped
+	EventServiceRemoved EventType = "ServiceRemoved"
+	// EventHealthChanged is emitted when a backend becomes healthy or unhealthy
+	EventHealthChanged EventType = "HealthChanged"
+	// EventNodeStateChanged is emitted when a service's tsnet node changes state
+	EventNodeStateChanged EventType = "NodeStateChanged"
+	// EventConfigUpdated is emitted after a service's configuration has been replaced
+	EventConfigUpdated EventType = "ConfigUpdated"
+)
+
+// Event describes a lifecycle change of a managed service
+type Event struct {
+	Type    EventType
+	Name    string
+	Service *Service
+
+	// Backend and Healthy are set for EventHealthChanged. Healthy reports
+	// the health of the whole service after the backend's change.
+	Backend *Backend
+	Healthy bool
+
+	// NodeState is the tsnet backend state (e.g. "Running") for EventNodeStateChanged
+	NodeState string
+}
+
+// subscriber queues events for one Subscribe caller. Lifecycle events drive
+// health checks and metrics, so they are never dropped: the queue grows while
+// the subscriber is behind.
+type subscriber struct {
+	ch     chan Event
+	mu     sync.Mutex
+	queue  []Event
+	notify chan struct{} // Signals that queue is not empty
+	done   chan struct{} // Closed on unsubscribe
+}
+
+// Subscribe registers for lifecycle events, which are delivered in order.
+// The returned function unsubscribes and closes the channel.
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	sub := &subscriber{
+		ch:     make(chan Event),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go sub.forward()
+
+	m.subMu.Lock()
+	m.subscribers[sub] = struct{}{}
+	m.subMu.Unlock()
+
+	unsubscribe := func() {
+		m.subMu.Lock()
+		defer m.subMu.Unlock()
+		if _, ok := m.subscribers[sub]; ok {
+			delete(m.subscribers, sub)
+			close(sub.done)
+		}
+	}
+	return sub.ch, unsubscribe
+}
+
+// publish queues an event for all subscribers without blocking
+func (m *Manager) publish(event Event) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for sub := range m.subscribers {
+		sub.mu.Lock()
+		sub.queue = append(sub.queue, event)
+		sub.mu.Unlock()
+
+		select {
+		case sub.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// forward sends queued events to the subscriber's channel until it
+// unsubscribes, then closes the channel
+func (sub *subscriber) forward() {
+	defer close(sub.ch)
+
+	for {
+		select {
+		case <-sub.notify:
+		case <-sub.done:
+			return
+		}
+
+		for {
+			sub.mu.Lock()
+			if len(sub.queue) == 0 {
+				sub.mu.Unlock()
+				break
+			}
+			event := sub.queue[0]
+			sub.queue[0] = Event{}
+			sub.queue = sub.queue[1:]
+			sub.mu.Unlock()
+
+			select {
+			case sub.ch <- event:
+			case <-sub.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPublishDoesNotDropEvents(t *testing.T) {
+	m := NewManager("", t.TempDir(), "", "")
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	// Flood the bus while nobody reads, ending with the final state
+	const count = 1000
+	for i := 0; i < count; i++ {
+		m.publish(Event{Type: EventConfigUpdated, Name: fmt.Sprintf("svc-%d", i)})
+	}
+	m.publish(Event{Type: EventServiceRemoved, Name: "svc-0"})
+
+	for i := 0; i <= count; i++ {
+		select {
+		case event := <-events:
+			want := fmt.Sprintf("svc-%d", i)
+			if i == count {
+				want = "svc-0"
+			}
+			if event.Name != want {
+				t.Fatalf("event %d is for %s, want %s", i, event.Name, want)
+			}
+			if i == count && event.Type != EventServiceRemoved {
+				t.Fatalf("final event is %s, want %s", event.Type, EventServiceRemoved)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only received %d of %d events", i, count+1)
+		}
+	}
+}
+
+func TestUnsubscribeClosesChannel(t *testing.T) {
+	m := NewManager("", t.TempDir(), "", "")
+	events, unsubscribe := m.Subscribe()
+	m.publish(Event{Type: EventServiceAdded, Name: "app"})
+
+	unsubscribe()
+	unsubscribe()
+
+	// Pending events may be discarded, but the channel must close
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel was not closed")
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// Headers describing the client's request to backends
+const (
+	HeaderForwarded       = "Forwarded"
+	HeaderXForwardedFor   = "X-Forwarded-For"
+	HeaderXForwardedHost  = "X-Forwarded-Host"
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+	HeaderXForwardedPort  = "X-Forwarded-Port"
+)
+
+var forwardedHeaders = []string{
+	HeaderForwarded,
+	HeaderXForwardedFor,
+	HeaderXForwardedHost,
+	HeaderXForwardedProto,
+	HeaderXForwardedPort,
+}
+
+// trustsProxy reports whether addr may pass on forwarding headers
+func (s *Service) trustsProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// setForwardedHeaders describes the client's request to the backend with the
+// X-Forwarded-* and RFC 7239 Forwarded headers. Values sent by trusted
+// proxies are kept and extended, those of other clients are replaced.
+func (s *Service) setForwardedHeaders(r *http.Request, port int) {
+	client, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !s.trustsProxy(client.Addr()) {
+		for _, name := range forwardedHeaders {
+			r.Header.Del(name)
+		}
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	if port == 0 {
+		port = 80
+		if r.TLS != nil {
+			port = 443
+		}
+	}
+
+	// The reverse proxy appends the client to X-Forwarded-For
+	setDefaultHeader(r.Header, HeaderXForwardedHost, r.Host)
+	setDefaultHeader(r.Header, HeaderXForwardedProto, proto)
+	setDefaultHeader(r.Header, HeaderXForwardedPort, strconv.Itoa(port))
+
+	node := "unknown"
+	if err == nil {
+		node = forwardedNode(client.Addr())
+	}
+	element := "for=" + node + ";host=" + quoteForwarded(r.Host) + ";proto=" + proto
+	if prior := r.Header.Values(HeaderForwarded); len(prior) > 0 {
+		element = strings.Join(prior, ", ") + ", " + element
+	}
+	r.Header.Set(HeaderForwarded, element)
+}
+
+// setHostHeader sets the Host header sent to backend according to the
+// service's hostHeader mode
+func (s *Service) setHostHeader(r *http.Request, backend *Backend) {
+	switch s.Config.HostHeader.Mode {
+	case config.HostHeaderBackend:
+		r.Host = backend.URL.Host
+	case config.HostHeaderCustom:
+		r.Host = s.Config.HostHeader.Value
+	}
+}
+
+// setDefaultHeader sets a header that is not present yet
+func setDefaultHeader(h http.Header, name, value string) {
+	if h.Get(name) == "" {
+		h.Set(name, value)
+	}
+}
+
+// forwardedNode formats an address as a Forwarded "for" value, IPv6
+// addresses are bracketed and quoted
+func forwardedNode(addr netip.Addr) string {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		return `"[` + addr.String() + `]"`
+	}
+	return addr.String()
+}
+
+// quoteForwarded returns v as a Forwarded token, or as a quoted string if it
+// contains other characters such as the ':' of a port
+func quoteForwarded(v string) string {
+	token := v != ""
+	for _, c := range v {
+		if !isTokenChar(c) {
+			token = false
+			break
+		}
+	}
+	if token {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// isTokenChar reports whether c may appear in an RFC 7230 token
+func isTokenChar(c rune) bool {
+	if c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestSetForwardedHeaders(t *testing.T) {
+	svc := &Service{trustedProxies: []netip.Prefix{netip.MustParsePrefix("100.64.0.0/24")}}
+
+	tests := []struct {
+		name          string
+		host          string
+		remoteAddr    string
+		tls           bool
+		port          int
+		prior         map[string]string
+		wantHost      string
+		wantProto     string
+		wantPort      string
+		wantForwarded string
+	}{
+		{
+			name:          "direct client",
+			remoteAddr:    "100.100.1.2:5000",
+			wantHost:      "app.example.ts.net",
+			wantProto:     "http",
+			wantPort:      "80",
+			wantForwarded: "for=100.100.1.2;host=app.example.ts.net;proto=http",
+		},
+		{
+			name:          "untrusted client spoofing headers",
+			remoteAddr:    "100.100.1.2:5000",
+			tls:           true,
+			prior:         map[string]string{"X-Forwarded-Host": "evil", "Forwarded": "for=1.2.3.4"},
+			wantHost:      "app.example.ts.net",
+			wantProto:     "https",
+			wantPort:      "443",
+			wantForwarded: "for=100.100.1.2;host=app.example.ts.net;proto=https",
+		},
+		{
+			name:          "trusted proxy",
+			remoteAddr:    "100.64.0.5:5000",
+			port:          8443,
+			prior:         map[string]string{"X-Forwarded-Host": "public.example.com", "Forwarded": "for=203.0.113.7"},
+			wantHost:      "public.example.com",
+			wantProto:     "http",
+			wantPort:      "8443",
+			wantForwarded: "for=203.0.113.7, for=100.64.0.5;host=app.example.ts.net;proto=http",
+		},
+		{
+			name:          "ipv6 client and host with port",
+			host:          "app.example.ts.net:8080",
+			remoteAddr:    "[fd7a:115c:a1e0::1]:5000",
+			port:          8080,
+			wantHost:      "app.example.ts.net:8080",
+			wantProto:     "http",
+			wantPort:      "8080",
+			wantForwarded: `for="[fd7a:115c:a1e0::1]";host="app.example.ts.net:8080";proto=http`,
+		},
+	}
+
+	for _, tt := range tests {
+		host := tt.host
+		if host == "" {
+			host = "app.example.ts.net"
+		}
+		r := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		for name, value := range tt.prior {
+			r.Header.Set(name, value)
+		}
+
+		svc.setForwardedHeaders(r, tt.port)
+
+		if got := r.Header.Get(HeaderXForwardedHost); got != tt.wantHost {
+			t.Errorf("%s: X-Forwarded-Host = %q, want %q", tt.name, got, tt.wantHost)
+		}
+		if got := r.Header.Get(HeaderXForwardedProto); got != tt.wantProto {
+			t.Errorf("%s: X-Forwarded-Proto = %q, want %q", tt.name, got, tt.wantProto)
+		}
+		if got := r.Header.Get(HeaderXForwardedPort); got != tt.wantPort {
+			t.Errorf("%s: X-Forwarded-Port = %q, want %q", tt.name, got, tt.wantPort)
+		}
+		if got := r.Header.Get(HeaderForwarded); got != tt.wantForwarded {
+			t.Errorf("%s: Forwarded = %q, want %q", tt.name, got, tt.wantForwarded)
+		}
+	}
+}
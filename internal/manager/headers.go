@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// headerRules is a compiled config.HeaderRules
+type headerRules struct {
+	set    []headerValue
+	add    []headerValue
+	remove []string
+}
+
+// headerValue is a header name with its value template
+type headerValue struct {
+	name string
+	tmpl *template.Template
+}
+
+// compileHeaderRules parses the value templates of cfg. It returns nil when
+// cfg changes nothing.
+func compileHeaderRules(cfg config.HeaderRules) (*headerRules, error) {
+	if cfg.IsEmpty() {
+		return nil, nil
+	}
+
+	set, err := compileHeaderValues(cfg.Set)
+	if err != nil {
+		return nil, err
+	}
+	add, err := compileHeaderValues(cfg.Add)
+	if err != nil {
+		return nil, err
+	}
+	return &headerRules{set: set, add: add, remove: cfg.Remove}, nil
+}
+
+// compileHeaderValues parses values, sorted by header name so that they are
+// applied in a stable order
+func compileHeaderValues(values map[string]string) ([]headerValue, error) {
+	compiled := make([]headerValue, 0, len(values))
+	for name, value := range values {
+		tmpl, err := config.ParseHeaderTemplate(name, value)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, headerValue{name: name, tmpl: tmpl})
+	}
+	slices.SortFunc(compiled, func(a, b headerValue) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return compiled, nil
+}
+
+// apply modifies h, rendering values with data
+func (rules *headerRules) apply(h http.Header, data map[string]string) {
+	if rules == nil {
+		return
+	}
+
+	for _, name := range rules.remove {
+		h.Del(name)
+	}
+	for _, v := range rules.set {
+		if value, ok := v.render(data); ok {
+			h.Set(v.name, value)
+		}
+	}
+	for _, v := range rules.add {
+		if value, ok := v.render(data); ok {
+			h.Add(v.name, value)
+		}
+	}
+}
+
+// render executes the value template, reporting whether it succeeded
+func (v headerValue) render(data map[string]string) (string, bool) {
+	var b strings.Builder
+	if err := v.tmpl.Execute(&b, data); err != nil {
+		log.Printf("Failed to render header %s: %v", v.name, err)
+		return "", false
+	}
+	return encodeHeaderValue(b.String()), true
+}
+
+// requestHeaders holds the header rules of a request on its way through the
+// proxy, with the values their templates may use
+type requestHeaders struct {
+	request  *headerRules
+	response *headerRules
+	data     map[string]string
+}
+
+type requestHeadersKey struct{}
+
+// withHeaderRules attaches the service's header rules to a request. The
+// backend proxy applies them in its Director and ModifyResponse hooks.
+func (s *Service) withHeaderRules(r *http.Request, who *apitype.WhoIsResponse) *http.Request {
+	if s.requestHeaders == nil && s.responseHeaders == nil {
+		return r
+	}
+
+	data := map[string]string{
+		"ClientIP":  r.RemoteAddr,
+		"UserLogin": "",
+		"NodeName":  "",
+		"RequestID": newRequestID(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		data["ClientIP"] = host
+	}
+	if who != nil {
+		if who.Node != nil {
+			data["NodeName"] = strings.TrimSuffix(who.Node.Name, ".")
+		}
+		// Tagged nodes are not owned by a user
+		if who.UserProfile != nil && (who.Node == nil || len(who.Node.Tags) == 0) {
+			data["UserLogin"] = who.UserProfile.LoginName
+		}
+	}
+
+	rh := &requestHeaders{request: s.requestHeaders, response: s.responseHeaders, data: data}
+	return r.WithContext(context.WithValue(r.Context(), requestHeadersKey{}, rh))
+}
+
+// applyRequestHeaders applies the request header rules attached to an
+// outgoing request
+func applyRequestHeaders(r *http.Request) {
+	if rh, ok := r.Context().Value(requestHeadersKey{}).(*requestHeaders); ok {
+		rh.request.apply(r.Header, rh.data)
+	}
+}
+
+// applyResponseHeaders applies the response header rules attached to the
+// request of a backend response
+func applyResponseHeaders(resp *http.Response) {
+	if rh, ok := resp.Request.Context().Value(requestHeadersKey{}).(*requestHeaders); ok {
+		rh.response.apply(resp.Header, rh.data)
+	}
+}
+
+// newRequestID returns a random identifier for a request
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
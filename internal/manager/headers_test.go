@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func TestRequestHeaderRules(t *testing.T) {
+	rules, err := compileHeaderRules(config.HeaderRules{
+		Set:    map[string]string{"X-User": "{{.UserLogin}}", "X-Client": "{{.ClientIP}} via {{.NodeName}}"},
+		Add:    map[string]string{"X-Tag": "proxied"},
+		Remove: []string{"X-Secret"},
+	})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+	svc := &Service{requestHeaders: rules}
+
+	who := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "laptop.example.ts.net."},
+		UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "100.64.0.1:41234"
+	r.Header.Set("X-User", "spoofed")
+	r.Header.Set("X-Secret", "token")
+	r.Header.Set("X-Tag", "client")
+
+	r = svc.withHeaderRules(r, who)
+	applyRequestHeaders(r)
+
+	if got := r.Header.Get("X-User"); got != "alice@example.com" {
+		t.Errorf("X-User = %q, want %q", got, "alice@example.com")
+	}
+	if got := r.Header.Get("X-Client"); got != "100.64.0.1 via laptop.example.ts.net" {
+		t.Errorf("X-Client = %q", got)
+	}
+	if got := r.Header.Values("X-Tag"); len(got) != 2 || got[1] != "proxied" {
+		t.Errorf("X-Tag = %q, want [client proxied]", got)
+	}
+	if got := r.Header.Get("X-Secret"); got != "" {
+		t.Errorf("X-Secret was not removed: %q", got)
+	}
+}
+
+func TestRequestHeaderRulesTaggedNode(t *testing.T) {
+	rules, err := compileHeaderRules(config.HeaderRules{Set: map[string]string{"X-User": "{{.UserLogin}}"}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+	svc := &Service{requestHeaders: rules}
+
+	// Tagged nodes are not owned by a user, so no login is passed on
+	who := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "ci.", Tags: []string{"tag:ci"}},
+		UserProfile: &tailcfg.UserProfile{LoginName: "tagged-devices"},
+	}
+	r := svc.withHeaderRules(httptest.NewRequest("GET", "/", nil), who)
+	applyRequestHeaders(r)
+
+	if got := r.Header.Get("X-User"); got != "" {
+		t.Errorf("X-User = %q, want empty", got)
+	}
+}
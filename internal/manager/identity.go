@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// Headers carrying the caller's Tailscale identity to backends
+const (
+	HeaderUserLogin      = "Tailscale-User-Login"
+	HeaderUserName       = "Tailscale-User-Name"
+	HeaderUserProfilePic = "Tailscale-User-Profile-Pic"
+	HeaderNodeName       = "Tailscale-Node-Name"
+	HeaderNodeTags       = "Tailscale-Node-Tags"
+	HeaderFunnelRequest  = "Tailscale-Funnel-Request" // Set on requests that came through Funnel
+)
+
+var identityHeaders = []string{
+	HeaderUserLogin,
+	HeaderUserName,
+	HeaderUserProfilePic,
+	HeaderNodeName,
+	HeaderNodeTags,
+	HeaderFunnelRequest,
+}
+
+// WhoIs resolves the Tailscale identity of the peer that sent the request
+func (s *Service) WhoIs(r *http.Request) (*apitype.WhoIsResponse, error) {
+	if s.node == nil {
+		return nil, fmt.Errorf("service %s has no tsnet node", s.Config.Name)
+	}
+
+	lc, err := s.node.ts.LocalClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LocalClient: %w", err)
+	}
+
+	who, err := lc.WhoIs(r.Context(), r.RemoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify %s: %w", r.RemoteAddr, err)
+	}
+	return who, nil
+}
+
+// stripIdentityHeaders removes client-supplied identity headers so backends
+// can trust the ones added by the proxy
+func stripIdentityHeaders(h http.Header) {
+	for _, name := range identityHeaders {
+		h.Del(name)
+	}
+}
+
+// setIdentityHeaders adds the caller's identity to the request headers.
+// Tagged nodes are not owned by a user, so only node headers are set for them.
+func setIdentityHeaders(h http.Header, who *apitype.WhoIsResponse) {
+	if who.Node != nil {
+		h.Set(HeaderNodeName, strings.TrimSuffix(who.Node.Name, "."))
+		if len(who.Node.Tags) > 0 {
+			h.Set(HeaderNodeTags, strings.Join(who.Node.Tags, ","))
+			return
+		}
+	}
+
+	if who.UserProfile != nil {
+		h.Set(HeaderUserLogin, encodeHeaderValue(who.UserProfile.LoginName))
+		h.Set(HeaderUserName, encodeHeaderValue(who.UserProfile.DisplayName))
+		if who.UserProfile.ProfilePicURL != "" {
+			h.Set(HeaderUserProfilePic, who.UserProfile.ProfilePicURL)
+		}
+	}
+}
+
+// encodeHeaderValue encodes non-ASCII values as RFC 2047 encoded words
+func encodeHeaderValue(v string) string {
+	for i := 0; i < len(v); i++ {
+		if v[i] >= utf8.RuneSelf {
+			return mime.QEncoding.Encode("utf-8", v)
+		}
+	}
+	return v
+}
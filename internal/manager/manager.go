@@ -2,18 +2,18 @@ package manager
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/NathanBhanji/tsnet-proxy/internal/access"
 	"github.com/NathanBhanji/tsnet-proxy/internal/config"
 	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn"
 	"tailscale.com/tsnet"
 )
 
@@ -24,7 +24,13 @@ type Manager struct {
 	stateDir  string
 	apiClient *tailscale.Client
 	tailnet   string
+	groups    config.Groups
 	mu        sync.RWMutex
+
+	middleware []Middleware // Applied to service handlers, guarded by mu
+
+	subMu       sync.Mutex
+	subscribers map[*subscriber]struct{}
 }
 
 // NewManager creates a new Manager instance
@@ -35,11 +41,12 @@ func NewManager(authKey, stateDir, apiKey, tailnet string) *Manager {
 	}
 
 	return &Manager{
-		services:  make(map[string]*Service),
-		authKey:   authKey,
-		stateDir:  stateDir,
-		apiClient: apiClient,
-		tailnet:   tailnet,
+		services:    make(map[string]*Service),
+		authKey:     authKey,
+		stateDir:    stateDir,
+		apiClient:   apiClient,
+		tailnet:     tailnet,
+		subscribers: make(map[*subscriber]struct{}),
 	}
 }
 
@@ -52,10 +59,13 @@ func (m *Manager) AddService(cfg config.ServiceConfig) error {
 		return fmt.Errorf("service %s already exists", cfg.Name)
 	}
 
-	log.Printf("Adding service: %s -> %s", cfg.Name, cfg.Backend)
+	log.Printf("Adding service: %s -> %s", cfg.Name, backendURLs(cfg))
 
 	// Create service instance
-	svc := NewService(cfg)
+	svc, err := NewService(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Create tsnet.Server with unique hostname
 	ts := &tsnet.Server{
@@ -70,67 +80,26 @@ func (m *Manager) AddService(cfg config.ServiceConfig) error {
 		return fmt.Errorf("failed to start tsnet server: %w", err)
 	}
 
-	// Create HTTPS listener with automatic Tailscale certificates
-	httpsLn, err := ts.ListenTLS("tcp", ":443")
-	if err != nil {
-		ts.Close()
-		return fmt.Errorf("failed to create HTTPS listener: %w", err)
-	}
-
-	// Create HTTP listener on port 80
-	httpLn, err := ts.Listen("tcp", ":80")
-	if err != nil {
-		ts.Close()
-		return fmt.Errorf("failed to create HTTP listener: %w", err)
-	}
-
-	// Parse backend URL
-	target, err := url.Parse(cfg.Backend)
-	if err != nil {
+	// Create HTTP handler with path routing and health checking
+	n := &node{name: cfg.Name, ts: ts}
+	svc.node = n
+	svc.publish = m.publish
+	svc.handler = m.createHandler(svc)
+	n.current.Store(svc)
+
+	// Listen on HTTP and HTTPS, or on the configured TCP ports
+	if err := n.reconcileListeners(listenerSpecs(cfg)); err != nil {
 		ts.Close()
-		return fmt.Errorf("invalid backend URL: %w", err)
-	}
-
-	// Create reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	// Customize transport for TLS backends
-	if cfg.TLS.Enabled {
-		proxy.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: cfg.TLS.SkipVerify,
-			},
-		}
+		return err
 	}
 
-	// Set up error handler
-	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("Proxy error for service %s: %v", cfg.Name, err)
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
-	}
-
-	// Create HTTP handler with path routing and health checking
-	handler := m.createHandler(svc, proxy)
-
-	// Start HTTPS server in goroutine
-	go func() {
-		log.Printf("Service %s listening on HTTPS (port 443) with Tailscale certificates", cfg.Name)
-		if err := http.Serve(httpsLn, handler); err != nil {
-			log.Printf("Service %s HTTPS stopped: %v", cfg.Name, err)
-		}
-	}()
+	// Follow tsnet node state changes until the service is removed
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	n.stopWatch = stopWatch
+	go m.watchNodeState(watchCtx, n)
 
-	// Start HTTP server in goroutine
-	go func() {
-		log.Printf("Service %s listening on HTTP (port 80)", cfg.Name)
-		if err := http.Serve(httpLn, handler); err != nil {
-			log.Printf("Service %s HTTP stopped: %v", cfg.Name, err)
-		}
-	}()
-
-	svc.tsnetServer = ts
-	svc.reverseProxy = proxy
 	m.services[cfg.Name] = svc
+	m.publish(Event{Type: EventServiceAdded, Name: cfg.Name, Service: svc})
 
 	log.Printf("Service %s started successfully", cfg.Name)
 	return nil
@@ -149,18 +118,79 @@ func (m *Manager) RemoveService(name string) error {
 	log.Printf("Removing service: %s", name)
 
 	// Delete device from Tailscale and close the tsnet server
-	if svc.tsnetServer != nil {
-		m.deleteDevice(svc.tsnetServer, name)
-		if err := svc.tsnetServer.Close(); err != nil {
+	if svc.node != nil {
+		svc.node.stopWatch()
+		m.deleteDevice(svc.node.ts, name)
+		if err := svc.node.ts.Close(); err != nil {
 			log.Printf("Error closing tsnet server for %s: %v", name, err)
 		}
 	}
 
 	delete(m.services, name)
+	m.publish(Event{Type: EventServiceRemoved, Name: name, Service: svc})
 	log.Printf("Service %s removed successfully", name)
 	return nil
 }
 
+// UpdateService replaces the configuration of a running service. The new
+// backends and handler are swapped in atomically while the service keeps its
+// tsnet server, and therefore its tailnet identity and certificates.
+func (m *Manager) UpdateService(cfg config.ServiceConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, exists := m.services[cfg.Name]
+	if !exists {
+		return fmt.Errorf("service %s not found", cfg.Name)
+	}
+
+	log.Printf("Updating service: %s -> %s", cfg.Name, backendURLs(cfg))
+
+	svc, err := NewService(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Keep health state of backends that survive the update
+	svc.inheritHealth(old)
+
+	svc.node = old.node
+	svc.publish = m.publish
+	svc.handler = m.createHandler(svc)
+
+	// In-flight requests finish on the previous handler
+	svc.node.current.Store(svc)
+
+	// Open and close listeners when the mode or ports changed
+	if err := svc.node.reconcileListeners(listenerSpecs(cfg)); err != nil {
+		svc.node.current.Store(old)
+		if rerr := svc.node.reconcileListeners(listenerSpecs(old.Config)); rerr != nil {
+			log.Printf("Failed to restore listeners for %s: %v", cfg.Name, rerr)
+		}
+		return err
+	}
+
+	m.services[cfg.Name] = svc
+	m.publish(Event{Type: EventConfigUpdated, Name: cfg.Name, Service: svc})
+
+	log.Printf("Service %s updated successfully", cfg.Name)
+	return nil
+}
+
+// SetGroups replaces the groups referenced by service access rules
+func (m *Manager) SetGroups(groups config.Groups) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.groups = groups
+}
+
+// Groups returns the groups referenced by service access rules
+func (m *Manager) Groups() config.Groups {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.groups
+}
+
 // GetService returns a service by name
 func (m *Manager) GetService(name string) (*Service, bool) {
 	m.mu.RLock()
@@ -183,45 +213,221 @@ func (m *Manager) GetAllServices() map[string]*Service {
 }
 
 // createHandler creates an HTTP handler with path routing and health checking
-func (m *Manager) createHandler(svc *Service, proxy *httputil.ReverseProxy) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if service is healthy
-		if !svc.IsHealthy() {
-			log.Printf("Service %s is unhealthy, returning 503", svc.Config.Name)
-			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+func (m *Manager) createHandler(svc *Service) http.Handler {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Listeners with their own backend bypass path routing and load balancing
+		spec, _ := listenerFromContext(r.Context())
+		override := svc.ListenerBackend(spec.port)
+
+		// Send plain HTTP to HTTPS, or tell browsers to stay on HTTPS
+		if override == nil && spec.protocol == protocolHTTP && svc.Config.HTTPRedirect.Mode == config.HTTPRedirectRedirect {
+			svc.redirectToHTTPS(w, r)
 			return
 		}
+		if spec.protocol == protocolHTTPS && svc.Config.HSTS.Enabled {
+			svc.setHSTS(w)
+		}
 
-		// Path-based routing
-		if len(svc.Config.Paths) > 0 {
-			matched := false
-			originalPath := r.URL.Path
-
-			for _, path := range svc.Config.Paths {
-				if strings.HasPrefix(r.URL.Path, path) {
-					matched = true
-					if svc.Config.StripPrefix {
-						// Strip the prefix before forwarding
-						r.URL.Path = strings.TrimPrefix(r.URL.Path, path)
-						if r.URL.Path == "" {
-							r.URL.Path = "/"
-						}
-					}
-					break
+		// Funnel requests come from the public internet and have their own
+		// path and credential checks instead of tailnet identities
+		funnel := isFunnelRequest(r)
+		if funnel {
+			if !access.FunnelPathAllowed(svc.Config.Funnel, r.URL.Path) {
+				setRequestError(r, ErrorDenied)
+				http.NotFound(w, r)
+				return
+			}
+			if !access.FunnelAuthorized(svc.Config.Funnel.Auth, r) {
+				log.Printf("Service %s: unauthorized Funnel request from %s", svc.Config.Name, r.RemoteAddr)
+				if len(svc.Config.Funnel.Auth.Users) > 0 {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", svc.Config.Name))
 				}
+				setRequestError(r, ErrorDenied)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Resolve the caller's Tailscale identity when it is needed
+		var who *apitype.WhoIsResponse
+		if !funnel && (svc.Config.IdentityHeaders || svc.Config.Access.Enabled() || svc.requestHeaders != nil || svc.responseHeaders != nil) {
+			var err error
+			who, err = svc.WhoIs(r)
+			if err != nil {
+				log.Printf("Service %s: %v", svc.Config.Name, err)
+			}
+		}
+
+		// Enforce access rules against the original request path
+		if !funnel && svc.Config.Access.Enabled() {
+			if who == nil {
+				setRequestError(r, ErrorDenied)
+				http.Error(w, "Forbidden: unable to identify caller", http.StatusForbidden)
+				return
+			}
+			if allowed, reason := access.Check(svc.Config.Access, m.Groups(), who, r.URL.Path); !allowed {
+				log.Printf("Service %s: access denied: %s", svc.Config.Name, reason)
+				setRequestError(r, ErrorDenied)
+				http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+				return
+			}
+		}
+
+		// Routes take precedence over the service's own paths and backends
+		var rt *route
+		var stripped string
+		if override == nil {
+			rt = svc.matchRoute(r)
+			if rt != nil && rt.Config.StripPrefix {
+				stripped = stripPathPrefix(r, rt.Config.Match.PathPrefix)
 			}
+		}
+		info := RequestInfoFrom(r)
+		if rt != nil && info != nil {
+			info.Route = rt.name
+		}
 
+		if override == nil && rt == nil && len(svc.backends) == 0 {
+			log.Printf("Service %s: %s %s did not match any route", svc.Config.Name, r.Method, r.URL.Path)
+			setRequestError(r, ErrorNoRoute)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Path-based routing
+		if override == nil && rt == nil && len(svc.Config.Paths) > 0 {
+			prefix, matched := longestPathPrefix(r.URL.Path, svc.Config.Paths)
 			if !matched {
-				log.Printf("Service %s: path %s did not match any configured paths", svc.Config.Name, originalPath)
+				log.Printf("Service %s: path %s did not match any configured paths", svc.Config.Name, r.URL.Path)
+				setRequestError(r, ErrorNoRoute)
 				http.NotFound(w, r)
 				return
 			}
+			if svc.Config.StripPrefix {
+				stripped = stripPathPrefix(r, prefix)
+			}
+		}
+
+		// Rewrite the path or redirect the client. Redirects need no
+		// backend, so health is only checked when picking one below.
+		if override == nil {
+			rewrites := svc.rewrites
+			if rt != nil {
+				rewrites = rt.rewrites
+			}
+			if applyRewrites(w, r, rewrites) {
+				return
+			}
+		}
+
+		// Pick a healthy backend
+		backend := override
+		if backend == nil {
+			if rt != nil {
+				backend = rt.next()
+			} else {
+				backend = svc.NextBackend()
+			}
+			if backend == nil {
+				log.Printf("Service %s has no healthy backends, returning 503", svc.Config.Name)
+				setRequestError(r, ErrorUnhealthy)
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
 		}
 
+		if info != nil {
+			info.Backend = backend.URL.String()
+		}
+
+		// Pass the caller's identity to the backend
+		stripIdentityHeaders(r.Header)
+		if svc.Config.IdentityHeaders && who != nil {
+			setIdentityHeaders(r.Header, who)
+		}
+		if funnel {
+			r.Header.Set(HeaderFunnelRequest, "?1")
+			if svc.Config.Funnel.Auth.Required() {
+				// The credentials are meant for the proxy
+				r.Header.Del("Authorization")
+			}
+		}
+
+		// Header rules are applied by the backend's proxy
+		r = svc.withHeaderRules(r, who)
+
+		// Restore the stripped prefix and public host in the response
+		if override == nil && svc.Config.ResponseRewrite.Enabled {
+			r = withResponseRewrite(r, svc.Config.ResponseRewrite, stripped)
+		}
+
+		// Describe the client's request and pick the Host for the backend
+		svc.setForwardedHeaders(r, spec.port)
+		svc.setHostHeader(r, backend)
+
 		// Forward to backend
-		log.Printf("Service %s: proxying %s %s to %s", svc.Config.Name, r.Method, r.URL.Path, svc.Config.Backend)
-		proxy.ServeHTTP(w, r)
+		log.Printf("Service %s: proxying %s %s to %s", svc.Config.Name, r.Method, r.URL.Path, backend.URL)
+		backend.ServeHTTP(w, r)
 	})
+
+	// Middleware sees the RequestInfo filled in by the handler
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		handler = m.middleware[i](svc.Config.Name, handler)
+	}
+	return withRequestInfo(handler)
+}
+
+// Middleware wraps the HTTP handler of a service
+type Middleware func(serviceName string, next http.Handler) http.Handler
+
+// Use adds middleware to the handlers of services added afterwards. The
+// first middleware added is the outermost.
+func (m *Manager) Use(mw Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middleware = append(m.middleware, mw)
+}
+
+// stripPathPrefix removes prefix from the request path before forwarding and
+// returns what was removed. prefix is matched on segment boundaries, so the
+// same number of segments is removed from the encoded path to keep escapes
+// such as %2F intact.
+func stripPathPrefix(r *http.Request, prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	r.URL.Path = ensureLeadingSlash(strings.TrimPrefix(r.URL.Path, prefix))
+	if r.URL.RawPath == "" {
+		return prefix
+	}
+
+	raw := r.URL.RawPath
+	for range strings.Count(prefix, "/") {
+		i := strings.IndexByte(raw[1:], '/')
+		if i < 0 {
+			raw = ""
+			break
+		}
+		raw = raw[i+1:]
+	}
+	r.URL.RawPath = ensureLeadingSlash(raw)
+
+	// Drop the encoded path if an escaped slash shifted the segments, the
+	// path is then re-encoded from r.URL.Path
+	if r.URL.EscapedPath() != r.URL.RawPath {
+		r.URL.RawPath = ""
+	}
+	return prefix
+}
+
+// ensureLeadingSlash makes an empty or relative path absolute
+func ensureLeadingSlash(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return "/" + p
+	}
+	return p
 }
 
 // Shutdown gracefully shuts down all services
@@ -232,16 +438,70 @@ func (m *Manager) Shutdown() {
 	log.Printf("Shutting down all services...")
 	for name, svc := range m.services {
 		log.Printf("Stopping service: %s", name)
-		if svc.tsnetServer != nil {
+		if svc.node != nil {
+			svc.node.stopWatch()
 			// Delete device from Tailscale before closing
-			m.deleteDevice(svc.tsnetServer, name)
-			svc.tsnetServer.Close()
+			m.deleteDevice(svc.node.ts, name)
+			svc.node.ts.Close()
 		}
+		m.publish(Event{Type: EventServiceRemoved, Name: name, Service: svc})
 	}
 	m.services = make(map[string]*Service)
 	log.Printf("All services stopped")
 }
 
+// watchNodeState follows the IPN bus of a service's tsnet node and emits
+// EventNodeStateChanged whenever the node's backend state changes
+func (m *Manager) watchNodeState(ctx context.Context, n *node) {
+	lc, err := n.ts.LocalClient()
+	if err != nil {
+		log.Printf("Failed to get LocalClient for %s: %v", n.name, err)
+		return
+	}
+
+	watcher, err := lc.WatchIPNBus(ctx, ipn.NotifyInitialState)
+	if err != nil {
+		log.Printf("Failed to watch node state for %s: %v", n.name, err)
+		return
+	}
+	defer watcher.Close()
+
+	for {
+		notify, err := watcher.Next()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Stopped watching node state for %s: %v", n.name, err)
+			}
+			return
+		}
+
+		if notify.State == nil {
+			continue
+		}
+
+		state := notify.State.String()
+		if prev, _ := n.state.Swap(state).(string); prev == state {
+			continue
+		}
+
+		log.Printf("Service %s node state changed to %s", n.name, state)
+		m.publish(Event{Type: EventNodeStateChanged, Name: n.name, Service: n.current.Load(), NodeState: state})
+	}
+}
+
+// backendURLs returns a printable list of the service's backend URLs
+func backendURLs(cfg config.ServiceConfig) string {
+	backends := cfg.BackendList()
+	urls := make([]string, 0, len(backends))
+	for _, backend := range backends {
+		urls = append(urls, backend.URL)
+	}
+	if len(cfg.Routes) > 0 {
+		urls = append(urls, fmt.Sprintf("%d routes", len(cfg.Routes)))
+	}
+	return strings.Join(urls, ", ")
+}
+
 // deleteDevice removes the device from Tailscale control plane
 func (m *Manager) deleteDevice(ts *tsnet.Server, name string) {
 	if m.apiClient == nil {
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+func TestStripPathPrefix(t *testing.T) {
+	tests := []struct {
+		target      string
+		prefix      string
+		wantPath    string
+		wantRawPath string
+		wantPrefix  string
+	}{
+		{"/api/users", "/api", "/users", "", "/api"},
+		{"/api/users", "/api/", "/users", "", "/api"},
+		{"/api", "/api", "/", "", "/api"},
+		{"/api/", "/api", "/", "", "/api"},
+		{"/api/v1/users", "/api/v1", "/users", "", "/api/v1"},
+		{"/api/files/a%2Fb", "/api", "/files/a/b", "/files/a%2Fb", "/api"},
+		{"/api/v1/a%2Fb", "/api/v1", "/a/b", "/a%2Fb", "/api/v1"},
+		{"/users", "/", "/users", "", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		prefix := stripPathPrefix(r, tt.prefix)
+
+		if prefix != tt.wantPrefix {
+			t.Errorf("stripPathPrefix(%q, %q) returned %q, want %q", tt.target, tt.prefix, prefix, tt.wantPrefix)
+		}
+		if r.URL.Path != tt.wantPath || r.URL.RawPath != tt.wantRawPath {
+			t.Errorf("stripPathPrefix(%q, %q): path %q raw %q, want %q raw %q",
+				tt.target, tt.prefix, r.URL.Path, r.URL.RawPath, tt.wantPath, tt.wantRawPath)
+		}
+	}
+}
+
+func TestStripPathPrefixEscapedSlashInPrefix(t *testing.T) {
+	// The decoded prefix spans an escaped slash, so the encoded path cannot
+	// be trimmed by segments and is derived from the decoded one instead
+	r := httptest.NewRequest("GET", "/a%2Fb/c", nil)
+	stripPathPrefix(r, "/a/b")
+
+	if r.URL.Path != "/c" || r.URL.RawPath != "" {
+		t.Errorf("path %q raw %q, want %q raw %q", r.URL.Path, r.URL.RawPath, "/c", "")
+	}
+}
+
+func TestLongestPathPrefix(t *testing.T) {
+	prefixes := []string{"/api", "/api/v2", "/static/"}
+
+	tests := []struct {
+		reqPath string
+		want    string
+		found   bool
+	}{
+		{"/api/users", "/api", true},
+		{"/api/v2/users", "/api/v2", true},
+		{"/api/v20", "/api", true},
+		{"/static", "/static/", true},
+		{"/apifoo", "", false},
+		{"/", "", false},
+	}
+
+	for _, tt := range tests {
+		got, found := longestPathPrefix(tt.reqPath, prefixes)
+		if got != tt.want || found != tt.found {
+			t.Errorf("longestPathPrefix(%q) = %q, %v, want %q, %v", tt.reqPath, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestRedirectRoutesWithoutHealthyBackends(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+	}{
+		{"redirect-only service", ""},
+		{"backends down", "http://app:80"},
+	}
+
+	for _, tt := range tests {
+		svc, err := NewService(config.ServiceConfig{
+			Name:    "app",
+			Mode:    config.ModeHTTP,
+			Backend: tt.backend,
+			Routes: []config.RouteConfig{{
+				Match:    config.RouteMatch{PathPrefix: "/old"},
+				Rewrites: []config.RewriteRule{{Redirect: "https://new.example.com/", Code: http.StatusPermanentRedirect}},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("%s: NewService: %v", tt.name, err)
+		}
+		for _, backend := range svc.Backends() {
+			backend.healthy.Store(false)
+		}
+		handler := NewManager("", t.TempDir(), "", "").createHandler(svc)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/old/page", nil))
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "https://new.example.com/" {
+			t.Errorf("%s: redirect route answered %d %q", tt.name, w.Code, w.Header().Get("Location"))
+		}
+
+		// Requests that need a backend still fail
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/other", nil))
+		want := http.StatusServiceUnavailable
+		if tt.backend == "" {
+			want = http.StatusNotFound
+		}
+		if w.Code != want {
+			t.Errorf("%s: other path answered %d, want %d", tt.name, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"tailscale.com/ipn"
+	"tailscale.com/tsnet"
+)
+
+// Listener protocols
+const (
+	protocolHTTP  = "http"
+	protocolHTTPS = "https"
+	protocolTCP   = "tcp"
+	protocolTLS   = "tls"
+	protocolUDP   = "udp"
+)
+
+// node is the tsnet server backing a service. It outlives individual Service
+// values so that UpdateService can swap a service's configuration without
+// changing its tailnet identity.
+type node struct {
+	name      string
+	ts        *tsnet.Server
+	current   atomic.Pointer[Service]
+	state     atomic.Value // string
+	stopWatch context.CancelFunc
+	listeners map[listenerSpec]io.Closer // Guarded by Manager.mu
+}
+
+// listenerSpec identifies a listener of a node
+type listenerSpec struct {
+	protocol   string
+	port       int
+	funnel     bool // Also accepts Funnel connections
+	funnelOnly bool // Only accepts Funnel connections
+}
+
+// listenerSpecs returns the listeners a service configuration needs
+func listenerSpecs(cfg config.ServiceConfig) []listenerSpec {
+	listeners := cfg.ListenerList()
+	specs := make([]listenerSpec, 0, len(listeners)+1)
+	funnelShared := false
+	for _, l := range listeners {
+		spec := listenerSpec{protocol: l.Protocol, port: l.Port}
+		if cfg.Funnel.Enabled && l.Port == cfg.Funnel.Port {
+			spec.funnel = true
+			funnelShared = true
+		}
+		specs = append(specs, spec)
+	}
+
+	if cfg.Funnel.Enabled && !funnelShared {
+		specs = append(specs, listenerSpec{protocol: protocolHTTPS, port: cfg.Funnel.Port, funnel: true, funnelOnly: true})
+	}
+	return specs
+}
+
+type (
+	listenerKey struct{}
+	funnelKey   struct{}
+)
+
+// listenerFromContext returns the listener an HTTP request arrived on
+func listenerFromContext(ctx context.Context) (listenerSpec, bool) {
+	spec, ok := ctx.Value(listenerKey{}).(listenerSpec)
+	return spec, ok
+}
+
+// isFunnelRequest reports whether the request came from the public internet
+// through Tailscale Funnel
+func isFunnelRequest(r *http.Request) bool {
+	funnel, _ := r.Context().Value(funnelKey{}).(bool)
+	return funnel
+}
+
+// RequestSource returns "funnel" for requests that came through Tailscale
+// Funnel and "tailnet" for all others
+func RequestSource(r *http.Request) string {
+	if isFunnelRequest(r) {
+		return "funnel"
+	}
+	return "tailnet"
+}
+
+// isFunnelConn reports whether the connection was accepted through Funnel
+func isFunnelConn(c net.Conn) bool {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	_, ok := c.(*ipn.FunnelConn)
+	return ok
+}
+
+// reconcileListeners opens the listeners in specs that are not open yet and
+// closes the ones no longer needed
+func (n *node) reconcileListeners(specs []listenerSpec) error {
+	if n.listeners == nil {
+		n.listeners = make(map[listenerSpec]io.Closer)
+	}
+
+	wanted := make(map[listenerSpec]bool)
+	for _, spec := range specs {
+		wanted[spec] = true
+	}
+
+	// Close first, a changed listener may reopen on the same port
+	for spec, ln := range n.listeners {
+		if !wanted[spec] {
+			ln.Close()
+			delete(n.listeners, spec)
+		}
+	}
+
+	for _, spec := range specs {
+		if _, open := n.listeners[spec]; open {
+			continue
+		}
+
+		ln, err := n.listen(spec)
+		if err != nil {
+			return fmt.Errorf("failed to create %s listener on port %d: %w", strings.ToUpper(spec.protocol), spec.port, err)
+		}
+		n.listeners[spec] = ln
+	}
+	return nil
+}
+
+// listen opens a tailnet listener for spec and starts serving it
+func (n *node) listen(spec listenerSpec) (io.Closer, error) {
+	if spec.protocol == protocolUDP {
+		return n.listenUDP(spec.port), nil
+	}
+
+	addr := fmt.Sprintf(":%d", spec.port)
+	var ln net.Listener
+	var err error
+	switch {
+	case spec.funnel:
+		// Accept connections from the public internet
+		var opts []tsnet.FunnelOption
+		if spec.funnelOnly {
+			opts = append(opts, tsnet.FunnelOnly())
+		}
+		ln, err = n.ts.ListenFunnel("tcp", addr, opts...)
+	case spec.protocol == protocolHTTPS || spec.protocol == protocolTLS:
+		// Serve with automatic Tailscale certificates
+		ln, err = n.ts.ListenTLS("tcp", addr)
+	default:
+		ln, err = n.ts.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go n.serve(spec, ln)
+	return ln, nil
+}
+
+// serve handles connections accepted by ln until it is closed
+func (n *node) serve(spec listenerSpec, ln net.Listener) {
+	if spec.funnel {
+		log.Printf("Service %s listening on %s (port %d) with Funnel", n.name, strings.ToUpper(spec.protocol), spec.port)
+	} else {
+		log.Printf("Service %s listening on %s (port %d)", n.name, strings.ToUpper(spec.protocol), spec.port)
+	}
+
+	var err error
+	if spec.protocol == protocolTCP || spec.protocol == protocolTLS {
+		err = n.serveTCP(ln, spec.port)
+	} else {
+		srv := &http.Server{
+			Handler: n,
+			ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+				ctx = context.WithValue(ctx, listenerKey{}, spec)
+				return context.WithValue(ctx, funnelKey{}, spec.funnel && isFunnelConn(c))
+			},
+		}
+		err = srv.Serve(ln)
+	}
+	log.Printf("Service %s %s (port %d) stopped: %v", n.name, strings.ToUpper(spec.protocol), spec.port, err)
+}
+
+// ServeHTTP dispatches the request to the handler of the node's current service
+func (n *node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.current.Load().handler.ServeHTTP(w, r)
+}
+
+// serveTCP forwards connections accepted by ln using the node's current service
+func (n *node) serveTCP(ln net.Listener, port int) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go n.current.Load().forwardTCP(conn, port)
+	}
+}
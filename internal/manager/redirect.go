@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// redirectToHTTPS redirects a plain HTTP request to the service's HTTPS
+// listener. The node's certificate name is used as the host, because short
+// MagicDNS names are not covered by the certificate.
+func (s *Service) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s.node != nil {
+		if domains := s.node.ts.CertDomains(); len(domains) > 0 {
+			host = domains[0]
+		}
+	}
+
+	for _, l := range s.Config.ListenerList() {
+		if l.Protocol == config.ListenerHTTPS && l.Backend == "" {
+			if l.Port != 443 {
+				host = net.JoinHostPort(host, strconv.Itoa(l.Port))
+			}
+			break
+		}
+	}
+
+	target := *r.URL
+	target.Scheme = "https"
+	target.Host = host
+	http.Redirect(w, r, target.String(), s.Config.HTTPRedirect.Code)
+}
+
+// setHSTS adds the Strict-Transport-Security header to a response
+func (s *Service) setHSTS(w http.ResponseWriter) {
+	w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", s.Config.HSTS.MaxAge))
+}
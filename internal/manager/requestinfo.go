@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Error classes of requests that were not proxied successfully
+const (
+	ErrorDenied    = "denied"    // Rejected by access rules or Funnel checks
+	ErrorNoRoute   = "no_route"  // No route or path matched
+	ErrorUnhealthy = "unhealthy" // No healthy backend
+	ErrorDial      = "dial"      // Backend could not be reached
+	ErrorTimeout   = "timeout"   // Backend did not answer in time
+	ErrorUpstream  = "upstream"  // Other proxy errors
+)
+
+// RequestInfo collects what the proxy learned while handling an HTTP request,
+// for middleware that records metrics
+type RequestInfo struct {
+	Route           string        // Name of the matched route, empty for the service's own backends
+	Backend         string        // URL of the backend the request was sent to
+	Error           string        // Error class, empty on success
+	UpstreamLatency time.Duration // Time until the backend's response headers arrived
+}
+
+type requestInfoKey struct{}
+
+// RequestInfoFrom returns the RequestInfo of a request handled by a service,
+// or nil
+func RequestInfoFrom(r *http.Request) *RequestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// withRequestInfo attaches an empty RequestInfo to every request before it
+// reaches next
+func withRequestInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, &RequestInfo{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// setRequestError records the error class of a request
+func setRequestError(r *http.Request, class string) {
+	if info := RequestInfoFrom(r); info != nil {
+		info.Error = class
+	}
+}
+
+// classifyProxyError maps an error of the reverse proxy to an error class
+func classifyProxyError(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err):
+		return ErrorTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ErrorDial
+	default:
+		return ErrorUpstream
+	}
+}
+
+// timedTransport records the upstream latency of requests in their RequestInfo
+type timedTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip forwards the request and measures the time until response headers
+func (t timedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	if info := RequestInfoFrom(r); info != nil {
+		info.UpstreamLatency = time.Since(start)
+	}
+	return resp, err
+}
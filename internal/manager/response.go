@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// maxRewriteBodySize is the largest response body whose links are rewritten,
+// larger bodies are passed through unchanged
+const maxRewriteBodySize = 10 << 20
+
+var (
+	// Root-relative links in HTML attributes and CSS url() values
+	htmlLinkPattern = regexp.MustCompile(`(?i)(\s(?:href|src|action|formaction|poster)\s*=\s*["']?)/([^/]|["'])`)
+	cssLinkPattern  = regexp.MustCompile(`(?i)(url\(\s*["']?)/([^/])`)
+)
+
+// responseRewrite describes how a request reached the proxy, so that backend
+// responses can point at the same place
+type responseRewrite struct {
+	body   bool
+	prefix string // Path prefix removed before forwarding, without trailing slash
+	scheme string // Public scheme and host of the request
+	host   string
+}
+
+type responseRewriteKey struct{}
+
+// withResponseRewrite marks a request so that the backend's response is
+// rewritten to include prefix and the request's public host
+func withResponseRewrite(r *http.Request, cfg config.ResponseRewriteConfig, prefix string) *http.Request {
+	rw := &responseRewrite{
+		body:   cfg.Body,
+		prefix: prefix,
+		scheme: "http",
+		host:   r.Host,
+	}
+	if r.TLS != nil {
+		rw.scheme = "https"
+	}
+
+	if rw.body {
+		// Compressed bodies cannot be rewritten
+		r.Header.Del("Accept-Encoding")
+	}
+	return r.WithContext(context.WithValue(r.Context(), responseRewriteKey{}, rw))
+}
+
+// rewriteResponse is the ModifyResponse hook of backend proxies. Requests not
+// marked by withResponseRewrite are left alone.
+func rewriteResponse(resp *http.Response) error {
+	rw, ok := resp.Request.Context().Value(responseRewriteKey{}).(*responseRewrite)
+	if !ok {
+		return nil
+	}
+	backendHost := resp.Request.URL.Host
+
+	for _, name := range []string{"Location", "Content-Location"} {
+		if value := resp.Header.Get(name); value != "" {
+			resp.Header.Set(name, rw.rewriteURL(value, backendHost))
+		}
+	}
+
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 {
+		resp.Header.Del("Set-Cookie")
+		for _, line := range cookies {
+			resp.Header.Add("Set-Cookie", rw.rewriteCookie(line, backendHost))
+		}
+	}
+
+	if rw.body {
+		return rw.rewriteBody(resp, backendHost)
+	}
+	return nil
+}
+
+// isOwnHost reports whether an absolute URL's host refers to the backend or
+// to the public host the backend saw in the Host header
+func (rw *responseRewrite) isOwnHost(host, backendHost string) bool {
+	return strings.EqualFold(host, backendHost) || strings.EqualFold(host, rw.host)
+}
+
+// rewriteURL prefixes root-relative URLs and moves absolute URLs of the
+// backend to the public host. Other URLs are returned unchanged.
+func (rw *responseRewrite) rewriteURL(raw, backendHost string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	switch {
+	case u.Host == "" && u.Scheme == "" && u.Opaque == "":
+		// Relative paths already resolve below the prefix
+		if !strings.HasPrefix(u.Path, "/") {
+			return raw
+		}
+	case u.Host != "" && rw.isOwnHost(u.Host, backendHost):
+		u.Scheme = rw.scheme
+		u.Host = rw.host
+	default:
+		return raw
+	}
+
+	u.Path = rw.prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = rw.prefix + u.RawPath
+	}
+	return u.String()
+}
+
+// rewriteCookie prefixes the path of a Set-Cookie header and replaces a
+// domain naming the backend with the public host
+func (rw *responseRewrite) rewriteCookie(line, backendHost string) string {
+	c, err := http.ParseSetCookie(line)
+	if err != nil {
+		return line
+	}
+
+	changed := false
+	if rw.prefix != "" && strings.HasPrefix(c.Path, "/") {
+		if c.Path == "/" {
+			c.Path = rw.prefix
+		} else {
+			c.Path = rw.prefix + c.Path
+		}
+		changed = true
+	}
+
+	if c.Domain != "" {
+		domain := strings.TrimPrefix(c.Domain, ".")
+		if strings.EqualFold(domain, hostname(backendHost)) {
+			c.Domain = hostname(rw.host)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return line
+	}
+	return c.String()
+}
+
+// rewriteBody rewrites links in HTML and CSS bodies that are not compressed
+func (rw *responseRewrite) rewriteBody(resp *http.Response, backendHost string) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "text/css" {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRewriteBodySize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxRewriteBodySize {
+		// Too large, pass on what was read followed by the rest
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	body = rw.rewriteLinks(body, backendHost, mediaType == "text/html")
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// rewriteLinks moves absolute links to the backend onto the public host and
+// prefix, and prefixes root-relative links
+func (rw *responseRewrite) rewriteLinks(body []byte, backendHost string, html bool) []byte {
+	prefix := strings.ReplaceAll(rw.prefix, "$", "$$")
+
+	// Both hosts in one pass, so rewritten links are not rewritten again
+	absolute := regexp.MustCompile(`(?i)(?:https?:)?//(?:` + regexp.QuoteMeta(backendHost) + `|` + regexp.QuoteMeta(rw.host) + `)([/?#"'\s)<>]|$)`)
+	body = absolute.ReplaceAll(body, []byte(rw.scheme+"://"+strings.ReplaceAll(rw.host, "$", "$$")+prefix+"${1}"))
+
+	if rw.prefix == "" {
+		return body
+	}
+	replacement := []byte("${1}" + prefix + "/${2}")
+	if html {
+		body = htmlLinkPattern.ReplaceAll(body, replacement)
+	}
+	return cssLinkPattern.ReplaceAll(body, replacement)
+}
+
+// hostname returns host without its port
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
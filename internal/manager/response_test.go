@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// testResponse returns a backend response to a request for app.example.ts.net
+// whose prefix /app was stripped before it was sent to backend:8080
+func testResponse(body bool, header http.Header, content string) *http.Response {
+	r := httptest.NewRequest("GET", "https://app.example.ts.net/app/page", nil)
+	r = withResponseRewrite(r, config.ResponseRewriteConfig{Enabled: true, Body: body}, "/app")
+	r.URL.Host = "backend:8080"
+
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       r,
+	}
+}
+
+func TestRewriteResponseLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{"/login", "/app/login"},
+		{"/login?next=/home#top", "/app/login?next=/home#top"},
+		{"login", "login"},
+		{"../login", "../login"},
+		{"http://backend:8080/login", "https://app.example.ts.net/app/login"},
+		{"https://app.example.ts.net/login", "https://app.example.ts.net/app/login"},
+		{"https://other.example.com/login", "https://other.example.com/login"},
+		{"mailto:admin@example.com", "mailto:admin@example.com"},
+	}
+
+	for _, tt := range tests {
+		resp := testResponse(false, http.Header{"Location": {tt.location}}, "")
+		if err := rewriteResponse(resp); err != nil {
+			t.Fatalf("rewriteResponse: %v", err)
+		}
+		if got := resp.Header.Get("Location"); got != tt.want {
+			t.Errorf("Location %q rewritten to %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteResponseCookies(t *testing.T) {
+	tests := []struct {
+		cookie string
+		want   string
+	}{
+		{"session=abc; Path=/", "session=abc; Path=/app"},
+		{"session=abc; Path=/api", "session=abc; Path=/app/api"},
+		{"session=abc; Path=/; Domain=backend", "session=abc; Path=/app; Domain=app.example.ts.net"},
+		{"session=abc; Domain=other.example.com", "session=abc; Domain=other.example.com"},
+		{"session=abc", "session=abc"},
+	}
+
+	for _, tt := range tests {
+		resp := testResponse(false, http.Header{"Set-Cookie": {tt.cookie}}, "")
+		if err := rewriteResponse(resp); err != nil {
+			t.Fatalf("rewriteResponse: %v", err)
+		}
+		if got := resp.Header.Get("Set-Cookie"); got != tt.want {
+			t.Errorf("Set-Cookie %q rewritten to %q, want %q", tt.cookie, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteResponseBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		want        string
+	}{
+		{
+			name:        "html links",
+			contentType: "text/html; charset=utf-8",
+			body:        `<a href="/docs">x</a><img src='/logo.png'><form action=/submit>`,
+			want:        `<a href="/app/docs">x</a><img src='/app/logo.png'><form action=/app/submit>`,
+		},
+		{
+			name:        "html root link",
+			contentType: "text/html",
+			body:        `<a href="/">home</a>`,
+			want:        `<a href="/app/">home</a>`,
+		},
+		{
+			name:        "absolute and protocol-relative links",
+			contentType: "text/html",
+			body:        `<a href="http://backend:8080/a">x</a><script src="//backend:8080/s.js"></script><a href="https://cdn.example.com/x">`,
+			want:        `<a href="https://app.example.ts.net/app/a">x</a><script src="https://app.example.ts.net/app/s.js"></script><a href="https://cdn.example.com/x">`,
+		},
+		{
+			name:        "relative and protocol-relative links of other hosts",
+			contentType: "text/html",
+			body:        `<a href="docs">x</a><img src="//cdn.example.com/i.png">`,
+			want:        `<a href="docs">x</a><img src="//cdn.example.com/i.png">`,
+		},
+		{
+			name:        "css urls",
+			contentType: "text/css",
+			body:        `body { background: url(/bg.png); } @font-face { src: url("/f.woff") }`,
+			want:        `body { background: url(/app/bg.png); } @font-face { src: url("/app/f.woff") }`,
+		},
+		{
+			name:        "text outside attributes",
+			contentType: "text/html",
+			body:        `<p>see /docs for details</p>`,
+			want:        `<p>see /docs for details</p>`,
+		},
+		{
+			name:        "compressed body",
+			contentType: "text/html",
+			encoding:    "gzip",
+			body:        `<a href="/docs">`,
+			want:        `<a href="/docs">`,
+		},
+		{
+			name:        "json body",
+			contentType: "application/json",
+			body:        `{"href": "/docs"}`,
+			want:        `{"href": "/docs"}`,
+		},
+		{
+			name:        "image body",
+			contentType: "image/png",
+			body:        "\x89PNG href=\"/x\"",
+			want:        "\x89PNG href=\"/x\"",
+		},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{
+			"Content-Type":   {tt.contentType},
+			"Content-Length": {strconv.Itoa(len(tt.body))},
+		}
+		if tt.encoding != "" {
+			header.Set("Content-Encoding", tt.encoding)
+		}
+		resp := testResponse(true, header, tt.body)
+
+		if err := rewriteResponse(resp); err != nil {
+			t.Fatalf("%s: rewriteResponse: %v", tt.name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != tt.want {
+			t.Errorf("%s: body = %s, want %s", tt.name, body, tt.want)
+		}
+		if resp.ContentLength != int64(len(body)) || resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+			t.Errorf("%s: Content-Length %d / %q does not match body length %d",
+				tt.name, resp.ContentLength, resp.Header.Get("Content-Length"), len(body))
+		}
+	}
+}
+
+func TestRewriteResponseBodyDisabled(t *testing.T) {
+	body := `<a href="/docs">`
+	resp := testResponse(false, http.Header{"Content-Type": {"text/html"}}, body)
+	if err := rewriteResponse(resp); err != nil {
+		t.Fatalf("rewriteResponse: %v", err)
+	}
+	if got, _ := io.ReadAll(resp.Body); string(got) != body {
+		t.Errorf("body = %s, want it unchanged", got)
+	}
+}
+
+func TestWithResponseRewriteDropsAcceptEncoding(t *testing.T) {
+	r := httptest.NewRequest("GET", "/app/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+
+	if got := withResponseRewrite(r, config.ResponseRewriteConfig{Enabled: true}, "/app"); got.Header.Get("Accept-Encoding") != "gzip" {
+		t.Error("Accept-Encoding removed although bodies are not rewritten")
+	}
+	if got := withResponseRewrite(r, config.ResponseRewriteConfig{Enabled: true, Body: true}, "/app"); got.Header.Get("Accept-Encoding") != "" {
+		t.Error("Accept-Encoding kept although bodies are rewritten")
+	}
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// rewriteRule is a rewrite rule with its compiled match expression
+type rewriteRule struct {
+	config.RewriteRule
+	pattern *regexp.Regexp // nil matches every path
+}
+
+// compileRewrites compiles the match expressions of rules
+func compileRewrites(rules []config.RewriteRule) ([]rewriteRule, error) {
+	compiled := make([]rewriteRule, 0, len(rules))
+	for _, rule := range rules {
+		rw := rewriteRule{RewriteRule: rule}
+		if rule.Match != "" {
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, err
+			}
+			rw.pattern = re
+		}
+		compiled = append(compiled, rw)
+	}
+	return compiled, nil
+}
+
+// applyRewrites rewrites the request path with rules in order. It returns
+// true if a rule redirected the client, in which case the request must not
+// be forwarded.
+func applyRewrites(w http.ResponseWriter, r *http.Request, rules []rewriteRule) bool {
+	for _, rule := range rules {
+		reqPath := r.URL.Path
+
+		var match []int
+		if rule.pattern != nil {
+			if match = rule.pattern.FindStringSubmatchIndex(reqPath); match == nil {
+				continue
+			}
+		}
+
+		switch {
+		case rule.Redirect != "":
+			target := rule.Redirect
+			if rule.pattern != nil {
+				target = string(rule.pattern.ExpandString(nil, rule.Redirect, reqPath, match))
+			}
+			if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, rule.Code)
+			return true
+		case rule.AddPrefix != "":
+			setRequestPath(r, rule.AddPrefix+reqPath)
+		default:
+			setRequestPath(r, rule.pattern.ReplaceAllString(reqPath, rule.Replace))
+		}
+	}
+	return false
+}
+
+// setRequestPath replaces the request path. The encoded form is dropped so
+// that it is derived from the new path when forwarding.
+func setRequestPath(r *http.Request, p string) {
+	r.URL.Path = ensureLeadingSlash(p)
+	r.URL.RawPath = ""
+}
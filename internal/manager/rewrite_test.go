@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+func TestApplyRewrites(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        []config.RewriteRule
+		target       string
+		wantPath     string
+		wantRedirect string
+		wantCode     int
+	}{
+		{
+			name:     "replace with capture group",
+			rules:    []config.RewriteRule{{Match: "^/v1/(.*)$", Replace: "/api/$1"}},
+			target:   "/v1/users",
+			wantPath: "/api/users",
+		},
+		{
+			name:     "no match",
+			rules:    []config.RewriteRule{{Match: "^/v1/(.*)$", Replace: "/api/$1"}},
+			target:   "/v2/users",
+			wantPath: "/v2/users",
+		},
+		{
+			name:     "add prefix to every path",
+			rules:    []config.RewriteRule{{AddPrefix: "/app"}},
+			target:   "/index.html",
+			wantPath: "/app/index.html",
+		},
+		{
+			name: "rules apply in order",
+			rules: []config.RewriteRule{
+				{Match: "^/old/(.*)$", Replace: "/new/$1"},
+				{Match: "^/new/", AddPrefix: "/v2"},
+			},
+			target:   "/old/page",
+			wantPath: "/v2/new/page",
+		},
+		{
+			name:         "redirect keeps query",
+			rules:        []config.RewriteRule{{Match: "^/docs/(.*)$", Redirect: "/help/$1", Code: http.StatusMovedPermanently}},
+			target:       "/docs/start?lang=en",
+			wantRedirect: "/help/start?lang=en",
+			wantCode:     http.StatusMovedPermanently,
+		},
+		{
+			name:         "redirect with own query",
+			rules:        []config.RewriteRule{{Match: "^/search$", Redirect: "/find?q=all", Code: http.StatusFound}},
+			target:       "/search?q=x",
+			wantRedirect: "/find?q=all",
+			wantCode:     http.StatusFound,
+		},
+	}
+
+	for _, tt := range tests {
+		rules, err := compileRewrites(tt.rules)
+		if err != nil {
+			t.Fatalf("%s: compileRewrites: %v", tt.name, err)
+		}
+
+		r := httptest.NewRequest("GET", tt.target, nil)
+		w := httptest.NewRecorder()
+		redirected := applyRewrites(w, r, rules)
+
+		if tt.wantRedirect != "" {
+			if !redirected || w.Code != tt.wantCode || w.Header().Get("Location") != tt.wantRedirect {
+				t.Errorf("%s: redirected %v with %d to %q, want %d to %q",
+					tt.name, redirected, w.Code, w.Header().Get("Location"), tt.wantCode, tt.wantRedirect)
+			}
+			continue
+		}
+		if redirected {
+			t.Errorf("%s: unexpected redirect to %q", tt.name, w.Header().Get("Location"))
+		}
+		if r.URL.Path != tt.wantPath {
+			t.Errorf("%s: path = %q, want %q", tt.name, r.URL.Path, tt.wantPath)
+		}
+	}
+}
+
+func TestSetRequestPathDropsRawPath(t *testing.T) {
+	r := httptest.NewRequest("GET", "/a%2Fb", nil)
+	setRequestPath(r, "c/d")
+
+	if r.URL.Path != "/c/d" || r.URL.RawPath != "" {
+		t.Errorf("path %q raw %q, want %q raw %q", r.URL.Path, r.URL.RawPath, "/c/d", "")
+	}
+}
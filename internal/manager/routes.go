@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/access"
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// route sends requests matching its conditions to its own backends
+type route struct {
+	Config    config.RouteConfig
+	name      string // Config.Name, or its position for unnamed routes
+	pathRegex *regexp.Regexp
+	rewrites  []rewriteRule
+	backends  []*Backend
+	balancer  Balancer
+}
+
+// newRoute creates a route, obtaining its backends from upstream
+func newRoute(cfg config.RouteConfig, upstream func(config.BackendConfig) (*Backend, error)) (*route, error) {
+	rt := &route{
+		Config:   cfg,
+		balancer: NewBalancer(cfg.LoadBalancing),
+	}
+
+	if cfg.Match.PathRegex != "" {
+		// Anchor the expression so it must match the whole path
+		re, err := regexp.Compile("^(?:" + cfg.Match.PathRegex + ")$")
+		if err != nil {
+			return nil, err
+		}
+		rt.pathRegex = re
+	}
+
+	rewrites, err := compileRewrites(cfg.Rewrites)
+	if err != nil {
+		return nil, err
+	}
+	rt.rewrites = rewrites
+
+	for _, backendCfg := range cfg.BackendList() {
+		backend, err := upstream(backendCfg)
+		if err != nil {
+			return nil, err
+		}
+		rt.backends = append(rt.backends, backend)
+	}
+	return rt, nil
+}
+
+// matches reports whether the request meets every condition of the route
+func (rt *route) matches(r *http.Request) bool {
+	match := rt.Config.Match
+
+	switch {
+	case match.PathPrefix != "":
+		if !access.HasPathPrefix(r.URL.Path, match.PathPrefix) {
+			return false
+		}
+	case match.Path != "":
+		if r.URL.Path != match.Path {
+			return false
+		}
+	case rt.pathRegex != nil:
+		if !rt.pathRegex.MatchString(r.URL.Path) {
+			return false
+		}
+	}
+
+	if len(match.Methods) > 0 && !slices.Contains(match.Methods, r.Method) {
+		return false
+	}
+
+	for name, value := range match.Headers {
+		values := r.Header.Values(name)
+		if len(values) == 0 || (value != "" && !slices.Contains(values, value)) {
+			return false
+		}
+	}
+
+	if match.Host != "" && !matchHost(match.Host, r.Host) {
+		return false
+	}
+
+	return true
+}
+
+// next selects a healthy backend of the route
+func (rt *route) next() *Backend {
+	return nextHealthy(rt.backends, rt.balancer)
+}
+
+// rank orders routes by how specific their path condition is: exact paths
+// first, then regular expressions, then prefixes from longest to shortest and
+// finally routes without a path condition
+func (rt *route) rank() int {
+	match := rt.Config.Match
+	switch {
+	case match.Path != "":
+		return math.MaxInt
+	case rt.pathRegex != nil:
+		return math.MaxInt - 1
+	case match.PathPrefix != "":
+		return 1 + len(strings.TrimSuffix(match.PathPrefix, "/"))
+	default:
+		return 0
+	}
+}
+
+// matchRoute returns the most specific route matching the request, or nil.
+// Routes of equal rank are tried in configuration order.
+func (s *Service) matchRoute(r *http.Request) *route {
+	var best *route
+	for _, rt := range s.routes {
+		if (best == nil || rt.rank() > best.rank()) && rt.matches(r) {
+			best = rt
+		}
+	}
+	return best
+}
+
+// longestPathPrefix returns the longest of prefixes that reqPath equals or
+// lies below, regardless of their order
+func longestPathPrefix(reqPath string, prefixes []string) (string, bool) {
+	longest, found := "", false
+	for _, prefix := range prefixes {
+		if access.HasPathPrefix(reqPath, prefix) && (!found || len(prefix) > len(longest)) {
+			longest, found = prefix, true
+		}
+	}
+	return longest, found
+}
+
+// matchHost matches a request host, ignoring its port, against a host name
+// or a "*.suffix" wildcard
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return len(host) > len(suffix)+1 && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(pattern, host)
+}
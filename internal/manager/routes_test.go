@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+func TestMatchRoute(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Name: "api", Match: config.RouteMatch{PathPrefix: "/api"}},
+		{Name: "api-v2", Match: config.RouteMatch{PathPrefix: "/api/v2/"}},
+		{Name: "health", Match: config.RouteMatch{Path: "/api/health"}},
+		{Name: "users", Match: config.RouteMatch{PathRegex: "/api/users/[0-9]+"}},
+		{Name: "writes", Match: config.RouteMatch{Methods: []string{"POST"}}},
+		{Name: "beta", Match: config.RouteMatch{PathPrefix: "/beta", Headers: map[string]string{"X-Beta": ""}}},
+		{Name: "wildcard", Match: config.RouteMatch{Host: "*.example.com"}},
+	}
+
+	svc := &Service{}
+	for _, cfg := range routes {
+		rt, err := newRoute(cfg, nil)
+		if err != nil {
+			t.Fatalf("newRoute(%s): %v", cfg.Name, err)
+		}
+		rt.name = cfg.Name
+		svc.routes = append(svc.routes, rt)
+	}
+
+	tests := []struct {
+		method  string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{"GET", "/api/items", nil, "api"},
+		{"GET", "/api", nil, "api"},
+		{"GET", "/apifoo", nil, ""},
+		{"GET", "/api/v2/items", nil, "api-v2"},
+		{"GET", "/api/v2", nil, "api-v2"},
+		{"GET", "/api/health", nil, "health"},
+		{"GET", "/api/users/42", nil, "users"},
+		{"GET", "/api/users/42/posts", nil, "api"},
+		{"POST", "/other", nil, "writes"},
+		{"POST", "/api/items", nil, "api"},
+		{"GET", "/beta/x", nil, ""},
+		{"GET", "/beta/x", map[string]string{"X-Beta": "1"}, "beta"},
+		{"GET", "http://app.example.com/", nil, "wildcard"},
+		{"GET", "http://example.com/", nil, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+
+		got := ""
+		if rt := svc.matchRoute(r); rt != nil {
+			got = rt.name
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: matched %q, want %q", tt.method, tt.target, got, tt.want)
+		}
+	}
+}
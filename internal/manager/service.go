@@ -1,46 +1,299 @@
 package manager
 
 import (
-	"net/http/httputil"
-	"sync/atomic"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
 
 	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tsnet"
 )
 
-// Service represents a running service with its tsnet server and reverse proxy
+// Service represents a running service with its tsnet server and backends
 type Service struct {
-	Config       config.ServiceConfig
-	tsnetServer  *tsnet.Server
-	reverseProxy *httputil.ReverseProxy
-	healthy      atomic.Bool
+	Config    config.ServiceConfig
+	node      *node
+	handler   http.Handler
+	backends  []*Backend // Default backends, used when no route matches
+	balancer  Balancer
+	routes    []*route
+	rewrites  []rewriteRule // Applied when no route matches
+	upstreams []*Backend    // Every distinct backend of the service and its routes
+	publish   func(Event)
+
+	listenerBackends map[int]*Backend // Backend overrides by listener port
+	requestHeaders   *headerRules
+	responseHeaders  *headerRules
+	trustedProxies   []netip.Prefix
 }
 
 // NewService creates a new Service instance
-func NewService(cfg config.ServiceConfig) *Service {
+func NewService(cfg config.ServiceConfig) (*Service, error) {
+	// Customize transport for TLS backends
+	var transport http.RoundTripper
+	if cfg.TLS.Enabled {
+		transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: cfg.TLS.SkipVerify,
+			},
+		}
+	}
+
+	rewrites, err := compileRewrites(cfg.Rewrites)
+	if err != nil {
+		return nil, err
+	}
+
+	requestHeaders, err := compileHeaderRules(cfg.RequestHeaders)
+	if err != nil {
+		return nil, err
+	}
+	responseHeaders, err := compileHeaderRules(cfg.ResponseHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	var trustedProxies []netip.Prefix
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := config.ParseTrustedProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		trustedProxies = append(trustedProxies, prefix)
+	}
+
 	svc := &Service{
-		Config: cfg,
+		Config:          cfg,
+		balancer:        NewBalancer(cfg.LoadBalancing),
+		rewrites:        rewrites,
+		requestHeaders:  requestHeaders,
+		responseHeaders: responseHeaders,
+		trustedProxies:  trustedProxies,
+	}
+
+	// Routes share backends with the service and each other by URL, so that
+	// every upstream is health checked once
+	pool := make(map[string]*Backend)
+	upstream := func(backendCfg config.BackendConfig) (*Backend, error) {
+		if backend, exists := pool[backendCfg.URL]; exists {
+			return backend, nil
+		}
+		backend, err := newBackend(cfg.Name, backendCfg, transport)
+		if err != nil {
+			return nil, err
+		}
+		pool[backendCfg.URL] = backend
+		svc.upstreams = append(svc.upstreams, backend)
+		return backend, nil
+	}
+
+	for _, backendCfg := range cfg.BackendList() {
+		backend, err := upstream(backendCfg)
+		if err != nil {
+			return nil, err
+		}
+		svc.backends = append(svc.backends, backend)
+	}
+
+	for i, routeCfg := range cfg.Routes {
+		rt, err := newRoute(routeCfg, upstream)
+		if err != nil {
+			return nil, err
+		}
+		rt.name = routeCfg.Name
+		if rt.name == "" {
+			rt.name = fmt.Sprintf("route-%d", i)
+		}
+		svc.routes = append(svc.routes, rt)
 	}
-	svc.healthy.Store(true) // Assume healthy initially
-	return svc
+
+	// Routes without backends only redirect, which validation ensures
+	if len(svc.upstreams) == 0 && len(svc.routes) == 0 {
+		return nil, fmt.Errorf("service %s has no backends", cfg.Name)
+	}
+
+	for _, l := range cfg.Listeners {
+		if l.Backend == "" {
+			continue
+		}
+		backend, err := newBackend(cfg.Name, config.BackendConfig{URL: l.Backend}, transport)
+		if err != nil {
+			return nil, err
+		}
+		if svc.listenerBackends == nil {
+			svc.listenerBackends = make(map[int]*Backend)
+		}
+		svc.listenerBackends[l.Port] = backend
+	}
+
+	return svc, nil
 }
 
-// IsHealthy returns the current health status
+// IsHealthy reports whether at least one backend is healthy. Services
+// without backends only redirect and are always healthy.
 func (s *Service) IsHealthy() bool {
-	return s.healthy.Load()
+	if len(s.upstreams) == 0 {
+		return true
+	}
+	for _, backend := range s.upstreams {
+		if backend.IsHealthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordCheck records a health check result for one of the service's
+// backends using the configured thresholds, emitting EventHealthChanged when
+// the backend's health changes. It returns true when the health changed.
+func (s *Service) RecordCheck(backend *Backend, checkErr error) bool {
+	cfg := s.Config.HealthCheck
+	if !backend.RecordCheck(checkErr, cfg.UnhealthyThreshold, cfg.HealthyThreshold) {
+		return false
+	}
+
+	if s.publish != nil {
+		s.publish(Event{
+			Type:    EventHealthChanged,
+			Name:    s.Config.Name,
+			Service: s,
+			Backend: backend,
+			Healthy: s.IsHealthy(),
+		})
+	}
+	return true
 }
 
-// SetHealthy updates the health status
-func (s *Service) SetHealthy(healthy bool) {
-	s.healthy.Store(healthy)
+// NodeState returns the last observed state of the service's tsnet node
+func (s *Service) NodeState() string {
+	if s.node == nil {
+		return ""
+	}
+	state, _ := s.node.state.Load().(string)
+	return state
 }
 
-// GetTsnetServer returns the tsnet server instance
-func (s *Service) GetTsnetServer() *tsnet.Server {
-	return s.tsnetServer
+// NodeStatus returns the current status of the service's tsnet node
+func (s *Service) NodeStatus(ctx context.Context) (*ipnstate.Status, error) {
+	if s.node == nil {
+		return nil, fmt.Errorf("service %s has no tsnet node", s.Config.Name)
+	}
+
+	lc, err := s.node.ts.LocalClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LocalClient: %w", err)
+	}
+	return lc.Status(ctx)
 }
 
-// GetReverseProxy returns the reverse proxy instance
-func (s *Service) GetReverseProxy() *httputil.ReverseProxy {
-	return s.reverseProxy
+// CertExpiry returns when the TLS certificate of the service's node expires.
+// It returns the zero time for services without TLS listeners, so that no
+// certificate is requested just to report on it.
+func (s *Service) CertExpiry(ctx context.Context) (time.Time, error) {
+	usesTLS := false
+	for _, spec := range listenerSpecs(s.Config) {
+		if spec.protocol == protocolHTTPS || spec.protocol == protocolTLS {
+			usesTLS = true
+		}
+	}
+	if !usesTLS || s.node == nil {
+		return time.Time{}, nil
+	}
+
+	domains := s.node.ts.CertDomains()
+	if len(domains) == 0 {
+		return time.Time{}, nil
+	}
+
+	lc, err := s.node.ts.LocalClient()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get LocalClient: %w", err)
+	}
+	certPEM, _, err := lc.CertPair(ctx, domains[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get certificate for %s: %w", domains[0], err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("invalid certificate for %s", domains[0])
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid certificate for %s: %w", domains[0], err)
+	}
+	return cert.NotAfter, nil
+}
+
+// inheritHealth copies the health state and traffic counters of backends
+// that are also present, by URL, in a previous instance of the service
+func (s *Service) inheritHealth(prev *Service) {
+	for _, backend := range s.upstreams {
+		for _, old := range prev.upstreams {
+			if backend.URL.String() == old.URL.String() {
+				backend.copyHealth(old)
+				backend.bytesSent.Store(old.bytesSent.Load())
+				backend.bytesReceived.Store(old.bytesReceived.Load())
+				break
+			}
+		}
+	}
+}
+
+// Backends returns every distinct backend of the service and its routes
+func (s *Service) Backends() []*Backend {
+	return s.upstreams
+}
+
+// DefaultBackends returns the backends that serve requests no route matches
+func (s *Service) DefaultBackends() []*Backend {
+	return s.backends
+}
+
+// ListenerBackend returns the backend configured for the listener on port,
+// or nil when the listener uses the service backends
+func (s *Service) ListenerBackend(port int) *Backend {
+	return s.listenerBackends[port]
+}
+
+// ForwardPort returns the first tailnet port whose TCP or UDP traffic goes to
+// the service backends. Backends without a port are addressed on it.
+func (s *Service) ForwardPort() int {
+	for _, l := range s.Config.ListenerList() {
+		if !l.IsHTTP() && l.Backend == "" {
+			return l.Port
+		}
+	}
+	return 0
+}
+
+// NextBackend selects a healthy default backend using the service's load
+// balancing strategy, returning nil when every backend is unhealthy
+func (s *Service) NextBackend() *Backend {
+	return nextHealthy(s.backends, s.balancer)
+}
+
+// nextHealthy selects one of the healthy backends with balancer
+func nextHealthy(backends []*Backend, balancer Balancer) *Backend {
+	healthy := make([]*Backend, 0, len(backends))
+	for _, backend := range backends {
+		if backend.IsHealthy() {
+			healthy = append(healthy, backend)
+		}
+	}
+	return balancer.Next(healthy)
+}
+
+// GetTsnetServer returns the tsnet server instance
+func (s *Service) GetTsnetServer() *tsnet.Server {
+	if s.node == nil {
+		return nil
+	}
+	return s.node.ts
 }
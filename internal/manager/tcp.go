@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// tcpDialTimeout bounds how long a connection waits for its backend
+const tcpDialTimeout = 10 * time.Second
+
+// forwardTCP splices a tailnet connection to one of the service's backends
+// until either side closes it or it stays idle for the configured timeout
+func (s *Service) forwardTCP(conn net.Conn, port int) {
+	defer conn.Close()
+
+	backend := s.ListenerBackend(port)
+	if backend == nil {
+		if s.Config.Mode != config.ModeTCP {
+			return
+		}
+		backend = s.NextBackend()
+		if backend == nil {
+			log.Printf("Service %s: no healthy backend for connection from %s", s.Config.Name, conn.RemoteAddr())
+			return
+		}
+	}
+
+	backend.active.Add(1)
+	defer backend.active.Add(-1)
+
+	upstream, err := net.DialTimeout("tcp", backend.Address(port), tcpDialTimeout)
+	if err != nil {
+		log.Printf("Proxy error for service %s (backend %s): %v", s.Config.Name, backend.URL, err)
+		return
+	}
+	defer upstream.Close()
+
+	idle := &idleTimer{timeout: s.Config.IdleTimeout}
+	idle.touch()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		splice(upstream, conn, idle, &backend.bytesSent)
+	}()
+	go func() {
+		defer wg.Done()
+		splice(conn, upstream, idle, &backend.bytesReceived)
+	}()
+	wg.Wait()
+}
+
+// splice copies from src to dst, counting the bytes copied. When src is
+// exhausted the write side of dst is closed so the peer sees EOF; on errors
+// both connections are closed to unblock the opposite direction.
+func splice(dst, src net.Conn, idle *idleTimer, counter *atomic.Int64) {
+	buf := make([]byte, 32*1024)
+	for {
+		if idle.timeout > 0 {
+			src.SetReadDeadline(time.Now().Add(idle.timeout))
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			idle.touch()
+			counter.Add(int64(n))
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				src.Close()
+				dst.Close()
+				return
+			}
+		}
+
+		if err != nil {
+			// Traffic in the other direction keeps the connection alive
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !idle.expired() {
+				continue
+			}
+
+			if errors.Is(err, io.EOF) {
+				if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+					cw.CloseWrite()
+					return
+				}
+			}
+			src.Close()
+			dst.Close()
+			return
+		}
+	}
+}
+
+// idleTimer tracks the last activity on either direction of a connection
+type idleTimer struct {
+	timeout time.Duration
+	last    atomic.Int64 // Unix nanoseconds
+}
+
+// touch records activity
+func (t *idleTimer) touch() {
+	t.last.Store(time.Now().UnixNano())
+}
+
+// expired reports whether the connection has been idle for the timeout
+func (t *idleTimer) expired() bool {
+	return time.Since(time.Unix(0, t.last.Load())) >= t.timeout
+}
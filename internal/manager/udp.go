@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+)
+
+// maxDatagramSize is the largest UDP payload that can be forwarded
+const maxDatagramSize = 64 * 1024
+
+// udpListener receives datagrams on a node's Tailscale addresses. Packet
+// listeners need the node's IPs, so they are opened once the node is up.
+type udpListener struct {
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	conns  []net.PacketConn
+	closed bool
+}
+
+// add registers a packet connection, returning false if the listener was
+// closed in the meantime
+func (l *udpListener) add(pc net.PacketConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.conns = append(l.conns, pc)
+	return true
+}
+
+// Close stops the listener and every session it created
+func (l *udpListener) Close() error {
+	l.cancel()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	for _, pc := range l.conns {
+		pc.Close()
+	}
+	return nil
+}
+
+// listenUDP listens for datagrams on port of each of the node's Tailscale
+// addresses and forwards them using the node's current service
+func (n *node) listenUDP(port int) *udpListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &udpListener{cancel: cancel}
+
+	go func() {
+		if _, err := n.ts.Up(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Service %s: failed to wait for node before listening on UDP port %d: %v", n.name, port, err)
+			}
+			return
+		}
+
+		ip4, ip6 := n.ts.TailscaleIPs()
+		for _, ip := range []netip.Addr{ip4, ip6} {
+			if !ip.IsValid() {
+				continue
+			}
+
+			addr := netip.AddrPortFrom(ip, uint16(port))
+			pc, err := n.ts.ListenPacket("udp", addr.String())
+			if err != nil {
+				log.Printf("Service %s: failed to listen on UDP %s: %v", n.name, addr, err)
+				continue
+			}
+			if !l.add(pc) {
+				pc.Close()
+				return
+			}
+
+			f := &udpForwarder{node: n, pc: pc, port: port, sessions: make(map[string]*udpSession)}
+			go f.serve(addr)
+		}
+	}()
+
+	return l
+}
+
+// udpForwarder relays datagrams between the clients of one packet
+// connection and the service's backends
+type udpForwarder struct {
+	node     *node
+	pc       net.PacketConn
+	port     int
+	mu       sync.Mutex
+	sessions map[string]*udpSession // By client address
+}
+
+// udpSession is the upstream socket of a single client
+type udpSession struct {
+	client   net.Addr
+	backend  *Backend
+	upstream net.Conn
+	idle     *idleTimer
+}
+
+// serve reads datagrams from clients until the packet connection is closed
+func (f *udpForwarder) serve(addr netip.AddrPort) {
+	log.Printf("Service %s listening on UDP (%s)", f.node.name, addr)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := f.pc.ReadFrom(buf)
+		if err != nil {
+			log.Printf("Service %s UDP (%s) stopped: %v", f.node.name, addr, err)
+			f.closeSessions()
+			return
+		}
+
+		sess, err := f.session(client)
+		if err != nil {
+			log.Printf("Service %s: dropping datagram from %s: %v", f.node.name, client, err)
+			continue
+		}
+
+		sess.idle.touch()
+		sess.backend.bytesSent.Add(int64(n))
+		if _, err := sess.upstream.Write(buf[:n]); err != nil {
+			log.Printf("Proxy error for service %s (backend %s): %v", f.node.name, sess.backend.URL, err)
+		}
+	}
+}
+
+// session returns the session of client, creating one on a backend chosen
+// by the current service if needed
+func (f *udpForwarder) session(client net.Addr) (*udpSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if sess, exists := f.sessions[client.String()]; exists {
+		return sess, nil
+	}
+
+	svc := f.node.current.Load()
+	if svc.Config.Mode != config.ModeUDP {
+		return nil, errors.New("service is not in udp mode")
+	}
+
+	backend := svc.NextBackend()
+	if backend == nil {
+		return nil, errors.New("no healthy backend")
+	}
+
+	upstream, err := net.Dial("udp", backend.Address(f.port))
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &udpSession{
+		client:   client,
+		backend:  backend,
+		upstream: upstream,
+		idle:     &idleTimer{timeout: svc.Config.IdleTimeout},
+	}
+	sess.idle.touch()
+	f.sessions[client.String()] = sess
+	backend.active.Add(1)
+
+	go f.reply(sess)
+	return sess, nil
+}
+
+// reply relays datagrams from the backend to the client until the session
+// has been idle for the service's timeout
+func (f *udpForwarder) reply(sess *udpSession) {
+	defer f.closeSession(sess)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		if sess.idle.timeout > 0 {
+			sess.upstream.SetReadDeadline(time.Now().Add(sess.idle.timeout))
+		}
+
+		n, err := sess.upstream.Read(buf)
+		if err != nil {
+			// Datagrams from the client keep the session alive
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !sess.idle.expired() {
+				continue
+			}
+			return
+		}
+
+		sess.idle.touch()
+		sess.backend.bytesReceived.Add(int64(n))
+		if _, err := f.pc.WriteTo(buf[:n], sess.client); err != nil {
+			return
+		}
+	}
+}
+
+// closeSession closes the upstream socket of a session and forgets it
+func (f *udpForwarder) closeSession(sess *udpSession) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sessions[sess.client.String()] == sess {
+		delete(f.sessions, sess.client.String())
+		sess.backend.active.Add(-1)
+	}
+	sess.upstream.Close()
+}
+
+// closeSessions closes every open session
+func (f *udpForwarder) closeSessions() {
+	f.mu.Lock()
+	sessions := make([]*udpSession, 0, len(f.sessions))
+	for _, sess := range f.sessions {
+		sessions = append(sessions, sess)
+	}
+	f.mu.Unlock()
+
+	for _, sess := range sessions {
+		f.closeSession(sess)
+	}
+}
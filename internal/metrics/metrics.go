@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"context"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -20,7 +22,7 @@ var (
 			Name: "tsnet_proxy_requests_total",
 			Help: "Total number of HTTP requests",
 		},
-		[]string{"service", "method", "status"},
+		[]string{"service", "route", "method", "status", "source", "error"},
 	)
 
 	requestDuration = promauto.NewHistogramVec(
@@ -29,7 +31,32 @@ var (
 			Help:    "HTTP request duration in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"service", "method"},
+		[]string{"service", "route", "method"},
+	)
+
+	upstreamDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tsnet_proxy_upstream_duration_seconds",
+			Help:    "Time until backend response headers in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "route", "backend"},
+	)
+
+	requestBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsnet_proxy_request_bytes_total",
+			Help: "Total bytes of HTTP request bodies",
+		},
+		[]string{"service", "route"},
+	)
+
+	responseBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsnet_proxy_response_bytes_total",
+			Help: "Total bytes of HTTP response bodies",
+		},
+		[]string{"service", "route"},
 	)
 
 	// Service health metrics
@@ -41,6 +68,40 @@ var (
 		[]string{"service"},
 	)
 
+	backendHealth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_backend_health",
+			Help: "Backend health status (1 = healthy, 0 = unhealthy)",
+		},
+		[]string{"service", "backend"},
+	)
+
+	// Health check metrics
+	healthCheckDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tsnet_proxy_health_check_duration_seconds",
+			Help:    "Health check duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "backend"},
+	)
+
+	healthChecksTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsnet_proxy_health_checks_total",
+			Help: "Total number of health checks by result",
+		},
+		[]string{"service", "backend", "result"},
+	)
+
+	healthCheckFailures = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_health_check_consecutive_failures",
+			Help: "Consecutive failed health checks of a backend",
+		},
+		[]string{"service", "backend"},
+	)
+
 	// Active connections
 	activeConnections = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -53,9 +114,11 @@ var (
 
 // MetricsServer handles Prometheus metrics
 type MetricsServer struct {
-	config  *config.Config
-	manager *manager.Manager
-	server  *http.Server
+	config      *config.Config
+	manager     *manager.Manager
+	server      *http.Server
+	unsubscribe func()
+	stopNodes   context.CancelFunc
 }
 
 // NewMetricsServer creates a new metrics server
@@ -88,43 +151,98 @@ func (m *MetricsServer) Start() error {
 		}
 	}()
 
-	// Start background metrics collector
-	go m.collectServiceMetrics()
+	// Follow manager events to keep service metrics current
+	events, unsubscribe := m.manager.Subscribe()
+	m.unsubscribe = unsubscribe
+	for _, svc := range m.manager.GetAllServices() {
+		updateServiceHealth(svc)
+	}
+	go m.collectServiceMetrics(events)
+
+	// Poll node status, which has no events for peers and expiry times
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stopNodes = cancel
+	go m.collectNodeMetrics(ctx)
 
 	return nil
 }
 
 // Stop stops the metrics server
 func (m *MetricsServer) Stop() {
+	if m.unsubscribe != nil {
+		m.unsubscribe()
+	}
+	if m.stopNodes != nil {
+		m.stopNodes()
+	}
 	if m.server != nil {
 		log.Printf("Stopping metrics server...")
 		m.server.Close()
 	}
 }
 
-// collectServiceMetrics periodically collects metrics from services
-func (m *MetricsServer) collectServiceMetrics() {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		services := m.manager.GetAllServices()
-		for name, svc := range services {
-			// Update health gauge
-			if svc.IsHealthy() {
-				serviceHealth.WithLabelValues(name).Set(1)
-			} else {
-				serviceHealth.WithLabelValues(name).Set(0)
-			}
+// collectServiceMetrics updates service metrics from manager lifecycle events
+func (m *MetricsServer) collectServiceMetrics(events <-chan manager.Event) {
+	for event := range events {
+		switch event.Type {
+		case manager.EventServiceAdded, manager.EventConfigUpdated, manager.EventHealthChanged:
+			updateServiceHealth(event.Service)
+		case manager.EventServiceRemoved:
+			serviceHealth.DeleteLabelValues(event.Name)
+			backendHealth.DeletePartialMatch(prometheus.Labels{"service": event.Name})
+			deleteServiceMetrics(event.Name)
+			deleteNodeMetrics(event.Name)
 		}
 	}
 }
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// updateServiceHealth sets the health gauges of a service and its backends
+func updateServiceHealth(svc *manager.Service) {
+	name := svc.Config.Name
+	serviceHealth.WithLabelValues(name).Set(boolToFloat(svc.IsHealthy()))
+
+	// Drop backends that no longer exist after a configuration update
+	backendHealth.DeletePartialMatch(prometheus.Labels{"service": name})
+	for _, backend := range svc.Backends() {
+		backendHealth.WithLabelValues(name, backend.URL.String()).Set(boolToFloat(backend.IsHealthy()))
+	}
+}
+
+// RecordHealthCheck records the outcome of a health check against a backend
+func RecordHealthCheck(service, backend, result string, duration time.Duration, consecutiveFailures int) {
+	healthCheckDuration.WithLabelValues(service, backend).Observe(duration.Seconds())
+	healthChecksTotal.WithLabelValues(service, backend, result).Inc()
+	healthCheckFailures.WithLabelValues(service, backend).Set(float64(consecutiveFailures))
+}
+
+// deleteServiceMetrics removes the request and health check metrics of a
+// removed service
+func deleteServiceMetrics(name string) {
+	labels := prometheus.Labels{"service": name}
+	requestsTotal.DeletePartialMatch(labels)
+	requestDuration.DeletePartialMatch(labels)
+	upstreamDuration.DeletePartialMatch(labels)
+	requestBytes.DeletePartialMatch(labels)
+	responseBytes.DeletePartialMatch(labels)
+	healthCheckDuration.DeletePartialMatch(labels)
+	healthChecksTotal.DeletePartialMatch(labels)
+	healthCheckFailures.DeletePartialMatch(labels)
+}
+
+// boolToFloat converts a boolean to a gauge value
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code and size
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	written    bool
+	bytes      int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -139,7 +257,27 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.written {
 		rw.WriteHeader(http.StatusOK)
 	}
-	return rw.ResponseWriter.Write(b)
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the Flusher and Hijacker of the
+// underlying writer, which streaming and WebSocket responses need
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
 }
 
 // MetricsMiddleware wraps an HTTP handler with Prometheus metrics collection
@@ -147,8 +285,13 @@ func MetricsMiddleware(serviceName string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		// Wrap response writer to capture status code
+		// Wrap response writer and body to capture status code and sizes
 		rw := &responseWriter{ResponseWriter: w, statusCode: 200}
+		var body *countingBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
 
 		// Track active connections
 		activeConnections.WithLabelValues(serviceName).Inc()
@@ -157,9 +300,20 @@ func MetricsMiddleware(serviceName string, next http.Handler) http.Handler {
 		// Handle request
 		next.ServeHTTP(rw, r)
 
-		// Record metrics
+		// Record metrics, with the route and outcome reported by the manager
 		duration := time.Since(start).Seconds()
-		requestsTotal.WithLabelValues(serviceName, r.Method, strconv.Itoa(rw.statusCode)).Inc()
-		requestDuration.WithLabelValues(serviceName, r.Method).Observe(duration)
+		info := manager.RequestInfoFrom(r)
+		if info == nil {
+			info = &manager.RequestInfo{}
+		}
+		requestsTotal.WithLabelValues(serviceName, info.Route, r.Method, strconv.Itoa(rw.statusCode), manager.RequestSource(r), info.Error).Inc()
+		requestDuration.WithLabelValues(serviceName, info.Route, r.Method).Observe(duration)
+		if info.UpstreamLatency > 0 {
+			upstreamDuration.WithLabelValues(serviceName, info.Route, info.Backend).Observe(info.UpstreamLatency.Seconds())
+		}
+		if body != nil {
+			requestBytes.WithLabelValues(serviceName, info.Route).Add(float64(body.bytes))
+		}
+		responseBytes.WithLabelValues(serviceName, info.Route).Add(float64(rw.bytes))
 	})
 }
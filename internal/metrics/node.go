@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// nodeMetricsInterval is how often node status is polled
+	nodeMetricsInterval = 30 * time.Second
+	nodeStatusTimeout   = 10 * time.Second
+
+	// certExpiryInterval is how often certificates are looked up, they
+	// change far less often than node status
+	certExpiryInterval = time.Hour
+)
+
+// nodeStates are the backend states of a tsnet node
+var nodeStates = []string{"NoState", "NeedsLogin", "NeedsMachineAuth", "Stopped", "Starting", "Running"}
+
+var (
+	nodeState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_node_state",
+			Help: "Backend state of the service's tsnet node (1 for the current state)",
+		},
+		[]string{"service", "state"},
+	)
+
+	nodePeers = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_node_peers",
+			Help: "Number of peers known to the service's tsnet node",
+		},
+		[]string{"service"},
+	)
+
+	nodePeerPaths = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_node_active_peers",
+			Help: "Number of active peers by path (direct or relay)",
+		},
+		[]string{"service", "path"},
+	)
+
+	nodeInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_node_info",
+			Help: "Tailnet addresses of the service's tsnet node (always 1)",
+		},
+		[]string{"service", "dns_name", "ipv4", "ipv6"},
+	)
+
+	nodeKeyExpiry = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_node_key_expiry_timestamp_seconds",
+			Help: "Unix time when the node key of the service's tsnet node expires",
+		},
+		[]string{"service"},
+	)
+
+	nodeCertExpiry = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tsnet_proxy_node_cert_expiry_timestamp_seconds",
+			Help: "Unix time when the TLS certificate of the service's tsnet node expires",
+		},
+		[]string{"service"},
+	)
+)
+
+// collectNodeMetrics polls the status of every service's node until ctx is
+// done
+func (m *MetricsServer) collectNodeMetrics(ctx context.Context) {
+	ticker := time.NewTicker(nodeMetricsInterval)
+	defer ticker.Stop()
+
+	polled := make(map[string]bool)
+	certs := make(map[string]*certCheck)
+	for {
+		current := make(map[string]bool)
+		for _, svc := range m.manager.GetAllServices() {
+			name := svc.Config.Name
+			if certs[name] == nil {
+				certs[name] = &certCheck{}
+			}
+			updateNodeMetrics(ctx, svc, certs[name])
+			current[name] = true
+		}
+
+		// Services removed while they were polled
+		for name := range polled {
+			if !current[name] {
+				deleteNodeMetrics(name)
+				delete(certs, name)
+			}
+		}
+		polled = current
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// certCheck tracks the certificate lookups of a service's node
+type certCheck struct {
+	svc     *manager.Service // Instance last looked up, updated services are checked right away
+	next    time.Time        // When to look up the certificate again
+	failing bool             // Whether the last lookup failed; failures are logged once
+}
+
+// updateNodeMetrics sets the node gauges of a service
+func updateNodeMetrics(ctx context.Context, svc *manager.Service, cert *certCheck) {
+	name := svc.Config.Name
+	ctx, cancel := context.WithTimeout(ctx, nodeStatusTimeout)
+	defer cancel()
+
+	status, err := svc.NodeStatus(ctx)
+	if err != nil {
+		log.Printf("Failed to get node status for %s: %v", name, err)
+		return
+	}
+
+	for _, state := range nodeStates {
+		nodeState.WithLabelValues(name, state).Set(boolToFloat(status.BackendState == state))
+	}
+	nodePeers.WithLabelValues(name).Set(float64(len(status.Peer)))
+
+	direct, relay := 0, 0
+	for _, peer := range status.Peer {
+		if !peer.Active {
+			continue
+		}
+		if peer.CurAddr != "" {
+			direct++
+		} else if peer.Relay != "" {
+			relay++
+		}
+	}
+	nodePeerPaths.WithLabelValues(name, "direct").Set(float64(direct))
+	nodePeerPaths.WithLabelValues(name, "relay").Set(float64(relay))
+
+	var dnsName, ipv4, ipv6 string
+	for _, ip := range status.TailscaleIPs {
+		if ip.Is4() {
+			ipv4 = ip.String()
+		} else {
+			ipv6 = ip.String()
+		}
+	}
+	if status.Self != nil {
+		dnsName = status.Self.DNSName
+		if status.Self.KeyExpiry != nil {
+			nodeKeyExpiry.WithLabelValues(name).Set(float64(status.Self.KeyExpiry.Unix()))
+		} else {
+			nodeKeyExpiry.DeleteLabelValues(name)
+		}
+	}
+	nodeInfo.DeletePartialMatch(prometheus.Labels{"service": name})
+	nodeInfo.WithLabelValues(name, dnsName, ipv4, ipv6).Set(1)
+
+	updateCertMetrics(ctx, svc, cert)
+}
+
+// updateCertMetrics sets the certificate expiry gauge of a service, looking
+// the certificate up at most once per certExpiryInterval
+func updateCertMetrics(ctx context.Context, svc *manager.Service, cert *certCheck) {
+	name := svc.Config.Name
+	now := time.Now()
+	if cert.svc == svc && now.Before(cert.next) {
+		return
+	}
+	cert.svc = svc
+	cert.next = now.Add(certExpiryInterval)
+
+	expiry, err := svc.CertExpiry(ctx)
+	if err != nil {
+		// HTTPS certificates may simply not be enabled on the tailnet
+		if !cert.failing {
+			log.Printf("Failed to get certificate expiry for %s, retrying every %s: %v", name, certExpiryInterval, err)
+		}
+		cert.failing = true
+		nodeCertExpiry.DeleteLabelValues(name)
+		return
+	}
+	cert.failing = false
+
+	if expiry.IsZero() {
+		nodeCertExpiry.DeleteLabelValues(name)
+	} else {
+		nodeCertExpiry.WithLabelValues(name).Set(float64(expiry.Unix()))
+	}
+}
+
+// deleteNodeMetrics removes the node metrics of a removed service
+func deleteNodeMetrics(name string) {
+	labels := prometheus.Labels{"service": name}
+	nodeState.DeletePartialMatch(labels)
+	nodePeers.DeletePartialMatch(labels)
+	nodePeerPaths.DeletePartialMatch(labels)
+	nodeInfo.DeletePartialMatch(labels)
+	nodeKeyExpiry.DeletePartialMatch(labels)
+	nodeCertExpiry.DeletePartialMatch(labels)
+}
@@ -0,0 +1,284 @@
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+)
+
+// Status describes the outcome of the most recent reload
+type Status struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	Added   []string  `json:"added"`
+	Updated []string  `json:"updated"`
+	Removed []string  `json:"removed"`
+}
+
+// Reloader owns the configuration file. It applies changes made to the file
+// to the running manager and persists changes made through the API.
+type Reloader struct {
+	path    string
+	config  *config.Config
+	manager *manager.Manager
+	history *config.History
+	mu      sync.Mutex
+	// applyMu serializes changes to the running services, so that API
+	// changes do not interleave with reloads
+	applyMu sync.Mutex
+	hash    [sha256.Size]byte
+	status  Status
+}
+
+// NewReloader creates a reloader for the configuration loaded from path
+func NewReloader(cfg *config.Config, path string, mgr *manager.Manager) *Reloader {
+	r := &Reloader{
+		path:    path,
+		config:  cfg,
+		manager: mgr,
+		history: config.NewHistory(filepath.Join(cfg.StateDir, "config-history"), cfg.HistorySize),
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		r.hash = sha256.Sum256(data)
+		r.record(data)
+	}
+	return r
+}
+
+// Watch polls the configuration file and reloads it whenever its content changes
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("Watching %s for changes (interval: %s)", r.path, interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(r.path)
+			if err != nil {
+				log.Printf("Failed to read config file: %v", err)
+				continue
+			}
+
+			r.mu.Lock()
+			changed := sha256.Sum256(data) != r.hash
+			r.mu.Unlock()
+
+			if changed {
+				log.Printf("Config file %s changed, reloading", r.path)
+				r.Reload()
+			}
+		}
+	}
+}
+
+// Reload loads the configuration file and applies the differences to the
+// running manager. When the file fails to load or validate the current
+// configuration stays live and the error is recorded in the status.
+func (r *Reloader) Reload() error {
+	r.applyMu.Lock()
+	defer r.applyMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return r.fail(fmt.Errorf("failed to read config file: %w", err))
+	}
+	r.hash = sha256.Sum256(data)
+
+	newCfg, err := config.Load(r.path)
+	if err != nil {
+		return r.fail(err)
+	}
+
+	r.warnRestartRequired(newCfg)
+
+	status := Status{Time: time.Now()}
+	var errs []error
+
+	// The stored configuration follows what actually runs: services that
+	// failed to start are left out and failed changes keep the old settings
+	var applied []config.ServiceConfig
+
+	running := r.manager.GetAllServices()
+	desired := make(map[string]bool, len(newCfg.Services))
+	for _, svcCfg := range newCfg.Services {
+		desired[svcCfg.Name] = true
+	}
+
+	// Remove services that are no longer configured
+	for name := range running {
+		if desired[name] {
+			continue
+		}
+		if err := r.manager.RemoveService(name); err != nil {
+			errs = append(errs, err)
+			applied = append(applied, running[name].Config)
+			continue
+		}
+		status.Removed = append(status.Removed, name)
+	}
+
+	// Add new services and update changed ones, leaving the rest untouched
+	for _, svcCfg := range newCfg.Services {
+		svc, exists := running[svcCfg.Name]
+		switch {
+		case !exists:
+			if err := r.manager.AddService(svcCfg); err != nil {
+				errs = append(errs, fmt.Errorf("service %s: %w", svcCfg.Name, err))
+				continue
+			}
+			status.Added = append(status.Added, svcCfg.Name)
+		case !reflect.DeepEqual(svc.Config, svcCfg):
+			if err := r.manager.UpdateService(svcCfg); err != nil {
+				errs = append(errs, fmt.Errorf("service %s: %w", svcCfg.Name, err))
+				applied = append(applied, svc.Config)
+				continue
+			}
+			status.Updated = append(status.Updated, svcCfg.Name)
+		}
+		applied = append(applied, svcCfg)
+	}
+
+	r.manager.SetGroups(newCfg.Groups)
+	r.config.Services = applied
+	r.config.Groups = newCfg.Groups
+	r.config.CopyDocument(newCfg)
+	r.record(data)
+
+	err = errors.Join(errs...)
+	status.Success = err == nil
+	if err != nil {
+		status.Error = err.Error()
+		log.Printf("Config reloaded with errors: %v", err)
+	}
+	r.status = status
+
+	log.Printf("Config reloaded: %d added, %d updated, %d removed",
+		len(status.Added), len(status.Updated), len(status.Removed))
+	return err
+}
+
+// fail records a failed reload and returns the error
+func (r *Reloader) fail(err error) error {
+	log.Printf("Config reload failed, keeping current configuration: %v", err)
+	r.status = Status{Time: time.Now(), Error: err.Error()}
+	return err
+}
+
+// warnRestartRequired logs global settings that cannot be applied without a restart
+func (r *Reloader) warnRestartRequired(newCfg *config.Config) {
+	if newCfg.AuthKey != r.config.AuthKey || newCfg.APIKey != r.config.APIKey ||
+		newCfg.Tailnet != r.config.Tailnet || newCfg.StateDir != r.config.StateDir {
+		log.Printf("Warning: changes to authKey, apiKey, tailnet or stateDir require a restart")
+	}
+	if !reflect.DeepEqual(newCfg.ManagementUI, r.config.ManagementUI) || !reflect.DeepEqual(newCfg.Metrics, r.config.Metrics) {
+		log.Printf("Warning: changes to managementUI or metrics require a restart")
+	}
+}
+
+// Status returns the outcome of the most recent reload
+func (r *Reloader) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Config returns a copy of the current configuration
+func (r *Reloader) Config() config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := *r.config
+	cfg.Services = append([]config.ServiceConfig(nil), r.config.Services...)
+	return cfg
+}
+
+// Lock blocks reloads and other API changes until Unlock. API handlers hold
+// it while they change the running services and save the configuration.
+func (r *Reloader) Lock() {
+	r.applyMu.Lock()
+}
+
+// Unlock allows reloads again
+func (r *Reloader) Unlock() {
+	r.applyMu.Unlock()
+}
+
+// Save applies mutate to the current configuration and writes it to the
+// configuration file without triggering a reload
+func (r *Reloader) Save(mutate func(cfg *config.Config)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mutate(r.config)
+
+	if err := config.Save(r.config, r.path); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	r.hash = sha256.Sum256(data)
+	r.record(data)
+	return nil
+}
+
+// History returns the stored configuration revisions, oldest first
+func (r *Reloader) History() ([]config.Revision, error) {
+	return r.history.List()
+}
+
+// Rollback restores an earlier configuration revision to the configuration
+// file and applies it to the running manager. Revisions that no longer
+// validate are rejected without touching the file.
+func (r *Reloader) Rollback(rev int) error {
+	data, err := r.history.Get(rev)
+	if err != nil {
+		return err
+	}
+
+	if _, err := config.Parse(data); err != nil {
+		return fmt.Errorf("revision %d is not valid: %w", rev, err)
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(r.path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	r.mu.Lock()
+	err = config.WriteFile(r.path, data, perm)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rolled back configuration to revision %d", rev)
+	return r.Reload()
+}
+
+// record stores data as a configuration revision
+func (r *Reloader) record(data []byte) {
+	if _, err := r.history.Record(data); err != nil {
+		log.Printf("Failed to record config revision: %v", err)
+	}
+}
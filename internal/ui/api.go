@@ -5,45 +5,66 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/NathanBhanji/tsnet-proxy/internal/config"
 	"github.com/NathanBhanji/tsnet-proxy/internal/health"
 	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+	"github.com/NathanBhanji/tsnet-proxy/internal/reload"
 )
 
 // APIHandler handles REST API requests
 type APIHandler struct {
 	manager       *manager.Manager
 	healthChecker *health.Checker
-	configPath    string
-	config        *config.Config
+	reloader      *reload.Reloader
 }
 
 // NewAPIHandler creates a new API handler
-func NewAPIHandler(mgr *manager.Manager, checker *health.Checker, cfg *config.Config, configPath string) *APIHandler {
+func NewAPIHandler(mgr *manager.Manager, checker *health.Checker, reloader *reload.Reloader) *APIHandler {
 	return &APIHandler{
 		manager:       mgr,
 		healthChecker: checker,
-		configPath:    configPath,
-		config:        cfg,
+		reloader:      reloader,
 	}
 }
 
 // ServiceResponse represents a service in API responses
 type ServiceResponse struct {
-	Name        string   `json:"name"`
-	Backend     string   `json:"backend"`
-	Paths       []string `json:"paths"`
-	StripPrefix bool     `json:"stripPrefix"`
-	Healthy     bool     `json:"healthy"`
-	HealthCheck struct {
+	Name            string                       `json:"name"`
+	Mode            string                       `json:"mode"`
+	Ports           []int                        `json:"ports,omitempty"`
+	Listeners       []config.ListenerConfig      `json:"listeners"`
+	IdleTimeout     string                       `json:"idleTimeout,omitempty"`
+	Backend         string                       `json:"backend"`
+	Backends        []BackendResponse            `json:"backends"`
+	RouteBackends   []BackendResponse            `json:"routeBackends"`
+	LoadBalancing   string                       `json:"loadBalancing"`
+	Paths           []string                     `json:"paths"`
+	Routes          []config.RouteConfig         `json:"routes"`
+	StripPrefix     bool                         `json:"stripPrefix"`
+	Rewrites        []config.RewriteRule         `json:"rewrites,omitempty"`
+	ResponseRewrite config.ResponseRewriteConfig `json:"responseRewrite"`
+	HostHeader      config.HostHeaderConfig      `json:"hostHeader"`
+	TrustedProxies  []string                     `json:"trustedProxies"`
+	RequestHeaders  config.HeaderRules           `json:"requestHeaders"`
+	ResponseHeaders config.HeaderRules           `json:"responseHeaders"`
+	IdentityHeaders bool                         `json:"identityHeaders"`
+	Access          config.AccessConfig          `json:"access"`
+	HTTPRedirect    config.HTTPRedirectConfig    `json:"httpRedirect"`
+	HSTS            config.HSTSConfig            `json:"hsts"`
+	Funnel          FunnelResponse               `json:"funnel"`
+	Healthy         bool                         `json:"healthy"`
+	HealthCheck     struct {
 		Enabled            bool   `json:"enabled"`
 		Path               string `json:"path"`
 		Interval           string `json:"interval"`
 		Timeout            string `json:"timeout"`
 		UnhealthyThreshold int    `json:"unhealthyThreshold"`
+		HealthyThreshold   int    `json:"healthyThreshold"`
+		ExpectBody         string `json:"expectBody,omitempty"`
 	} `json:"healthCheck"`
 	TLS struct {
 		Enabled    bool `json:"enabled"`
@@ -51,6 +72,102 @@ type ServiceResponse struct {
 	} `json:"tls"`
 }
 
+// FunnelResponse represents the Funnel settings of a service without its credentials
+type FunnelResponse struct {
+	Enabled      bool     `json:"enabled"`
+	Port         int      `json:"port"`
+	Paths        []string `json:"paths"`
+	AuthRequired bool     `json:"authRequired"`
+}
+
+// BackendResponse represents a single backend in API responses
+type BackendResponse struct {
+	URL                  string    `json:"url"`
+	Weight               int       `json:"weight"`
+	Healthy              bool      `json:"healthy"`
+	ActiveRequests       int64     `json:"activeRequests"`
+	BytesSent            int64     `json:"bytesSent"`
+	BytesReceived        int64     `json:"bytesReceived"`
+	ConsecutiveFailures  int       `json:"consecutiveFailures"`
+	ConsecutiveSuccesses int       `json:"consecutiveSuccesses"`
+	LastCheck            time.Time `json:"lastCheck"`
+	LastError            string    `json:"lastError,omitempty"`
+}
+
+// newServiceResponse converts a running service to its API representation
+func newServiceResponse(svc *manager.Service) ServiceResponse {
+	svcResp := ServiceResponse{
+		Name:            svc.Config.Name,
+		Mode:            svc.Config.Mode,
+		Ports:           svc.Config.Ports,
+		Listeners:       svc.Config.ListenerList(),
+		Backend:         svc.Config.Backend,
+		LoadBalancing:   svc.Config.LoadBalancing,
+		Paths:           svc.Config.Paths,
+		Routes:          svc.Config.Routes,
+		StripPrefix:     svc.Config.StripPrefix,
+		Rewrites:        svc.Config.Rewrites,
+		ResponseRewrite: svc.Config.ResponseRewrite,
+		HostHeader:      svc.Config.HostHeader,
+		TrustedProxies:  svc.Config.TrustedProxies,
+		RequestHeaders:  svc.Config.RequestHeaders,
+		ResponseHeaders: svc.Config.ResponseHeaders,
+		IdentityHeaders: svc.Config.IdentityHeaders,
+		Access:          svc.Config.Access,
+		HTTPRedirect:    svc.Config.HTTPRedirect,
+		HSTS:            svc.Config.HSTS,
+		Healthy:         svc.IsHealthy(),
+	}
+	svcResp.Funnel = FunnelResponse{
+		Enabled:      svc.Config.Funnel.Enabled,
+		Port:         svc.Config.Funnel.Port,
+		Paths:        svc.Config.Funnel.Paths,
+		AuthRequired: svc.Config.Funnel.Auth.Required(),
+	}
+	// Route upstreams are reported separately so that the default backends
+	// can be edited without picking them up
+	defaults := make(map[*manager.Backend]bool)
+	for _, backend := range svc.DefaultBackends() {
+		defaults[backend] = true
+		svcResp.Backends = append(svcResp.Backends, newBackendResponse(backend))
+	}
+	for _, backend := range svc.Backends() {
+		if !defaults[backend] {
+			svcResp.RouteBackends = append(svcResp.RouteBackends, newBackendResponse(backend))
+		}
+	}
+	if svc.Config.IdleTimeout > 0 {
+		svcResp.IdleTimeout = svc.Config.IdleTimeout.String()
+	}
+	svcResp.HealthCheck.Enabled = svc.Config.HealthCheck.Enabled
+	svcResp.HealthCheck.Path = svc.Config.HealthCheck.Path
+	svcResp.HealthCheck.Interval = svc.Config.HealthCheck.Interval.String()
+	svcResp.HealthCheck.Timeout = svc.Config.HealthCheck.Timeout.String()
+	svcResp.HealthCheck.UnhealthyThreshold = svc.Config.HealthCheck.UnhealthyThreshold
+	svcResp.HealthCheck.HealthyThreshold = svc.Config.HealthCheck.HealthyThreshold
+	svcResp.HealthCheck.ExpectBody = svc.Config.HealthCheck.ExpectBody
+	svcResp.TLS.Enabled = svc.Config.TLS.Enabled
+	svcResp.TLS.SkipVerify = svc.Config.TLS.SkipVerify
+	return svcResp
+}
+
+// newBackendResponse converts a backend to its API representation
+func newBackendResponse(backend *manager.Backend) BackendResponse {
+	health := backend.Health()
+	return BackendResponse{
+		URL:                  backend.URL.String(),
+		Weight:               backend.Weight,
+		Healthy:              health.Healthy,
+		ActiveRequests:       backend.ActiveRequests(),
+		BytesSent:            backend.BytesSent(),
+		BytesReceived:        backend.BytesReceived(),
+		ConsecutiveFailures:  health.ConsecutiveFailures,
+		ConsecutiveSuccesses: health.ConsecutiveSuccesses,
+		LastCheck:            health.LastCheck,
+		LastError:            health.LastError,
+	}
+}
+
 // ListServices returns all services
 func (h *APIHandler) ListServices(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -62,22 +179,7 @@ func (h *APIHandler) ListServices(w http.ResponseWriter, r *http.Request) {
 	response := make([]ServiceResponse, 0, len(services))
 
 	for _, svc := range services {
-		svcResp := ServiceResponse{
-			Name:        svc.Config.Name,
-			Backend:     svc.Config.Backend,
-			Paths:       svc.Config.Paths,
-			StripPrefix: svc.Config.StripPrefix,
-			Healthy:     svc.IsHealthy(),
-		}
-		svcResp.HealthCheck.Enabled = svc.Config.HealthCheck.Enabled
-		svcResp.HealthCheck.Path = svc.Config.HealthCheck.Path
-		svcResp.HealthCheck.Interval = svc.Config.HealthCheck.Interval.String()
-		svcResp.HealthCheck.Timeout = svc.Config.HealthCheck.Timeout.String()
-		svcResp.HealthCheck.UnhealthyThreshold = svc.Config.HealthCheck.UnhealthyThreshold
-		svcResp.TLS.Enabled = svc.Config.TLS.Enabled
-		svcResp.TLS.SkipVerify = svc.Config.TLS.SkipVerify
-
-		response = append(response, svcResp)
+		response = append(response, newServiceResponse(svc))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -105,37 +207,42 @@ func (h *APIHandler) GetService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	svcResp := ServiceResponse{
-		Name:        svc.Config.Name,
-		Backend:     svc.Config.Backend,
-		Paths:       svc.Config.Paths,
-		StripPrefix: svc.Config.StripPrefix,
-		Healthy:     svc.IsHealthy(),
-	}
-	svcResp.HealthCheck.Enabled = svc.Config.HealthCheck.Enabled
-	svcResp.HealthCheck.Path = svc.Config.HealthCheck.Path
-	svcResp.HealthCheck.Interval = svc.Config.HealthCheck.Interval.String()
-	svcResp.HealthCheck.Timeout = svc.Config.HealthCheck.Timeout.String()
-	svcResp.HealthCheck.UnhealthyThreshold = svc.Config.HealthCheck.UnhealthyThreshold
-	svcResp.TLS.Enabled = svc.Config.TLS.Enabled
-	svcResp.TLS.SkipVerify = svc.Config.TLS.SkipVerify
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(svcResp)
+	json.NewEncoder(w).Encode(newServiceResponse(svc))
 }
 
 // ServiceRequest represents the JSON request for adding a service
 type ServiceRequest struct {
-	Name        string   `json:"name"`
-	Backend     string   `json:"backend"`
-	Paths       []string `json:"paths"`
-	StripPrefix bool     `json:"stripPrefix"`
-	HealthCheck struct {
+	Name            string                       `json:"name"`
+	Mode            string                       `json:"mode"`
+	Ports           []int                        `json:"ports"`
+	Listeners       []config.ListenerConfig      `json:"listeners"`
+	IdleTimeout     string                       `json:"idleTimeout"`
+	Backend         string                       `json:"backend"`
+	Backends        []config.BackendConfig       `json:"backends"`
+	LoadBalancing   string                       `json:"loadBalancing"`
+	Paths           []string                     `json:"paths"`
+	Routes          []config.RouteConfig         `json:"routes"`
+	StripPrefix     bool                         `json:"stripPrefix"`
+	Rewrites        []config.RewriteRule         `json:"rewrites,omitempty"`
+	ResponseRewrite config.ResponseRewriteConfig `json:"responseRewrite"`
+	HostHeader      config.HostHeaderConfig      `json:"hostHeader"`
+	TrustedProxies  []string                     `json:"trustedProxies"`
+	RequestHeaders  config.HeaderRules           `json:"requestHeaders"`
+	ResponseHeaders config.HeaderRules           `json:"responseHeaders"`
+	IdentityHeaders bool                         `json:"identityHeaders"`
+	Access          config.AccessConfig          `json:"access"`
+	HTTPRedirect    config.HTTPRedirectConfig    `json:"httpRedirect"`
+	HSTS            config.HSTSConfig            `json:"hsts"`
+	Funnel          config.FunnelConfig          `json:"funnel"`
+	HealthCheck     struct {
 		Enabled            bool   `json:"enabled"`
 		Path               string `json:"path"`
 		Interval           string `json:"interval"`
 		Timeout            string `json:"timeout"`
 		UnhealthyThreshold int    `json:"unhealthyThreshold"`
+		HealthyThreshold   int    `json:"healthyThreshold"`
+		ExpectBody         string `json:"expectBody,omitempty"`
 	} `json:"healthCheck"`
 	TLS struct {
 		Enabled    bool `json:"enabled"`
@@ -143,25 +250,70 @@ type ServiceRequest struct {
 	} `json:"tls"`
 }
 
-// AddService adds a new service
-func (h *APIHandler) AddService(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// newServiceRequest converts a service configuration to its request representation
+func newServiceRequest(cfg config.ServiceConfig) ServiceRequest {
+	req := ServiceRequest{
+		Name:            cfg.Name,
+		Mode:            cfg.Mode,
+		Ports:           cfg.Ports,
+		Listeners:       cfg.Listeners,
+		Backend:         cfg.Backend,
+		Backends:        cfg.Backends,
+		LoadBalancing:   cfg.LoadBalancing,
+		Paths:           cfg.Paths,
+		Routes:          cfg.Routes,
+		StripPrefix:     cfg.StripPrefix,
+		Rewrites:        cfg.Rewrites,
+		ResponseRewrite: cfg.ResponseRewrite,
+		HostHeader:      cfg.HostHeader,
+		TrustedProxies:  cfg.TrustedProxies,
+		RequestHeaders:  cfg.RequestHeaders,
+		ResponseHeaders: cfg.ResponseHeaders,
+		IdentityHeaders: cfg.IdentityHeaders,
+		Access:          cfg.Access,
+		HTTPRedirect:    cfg.HTTPRedirect,
+		HSTS:            cfg.HSTS,
+		Funnel:          cfg.Funnel,
 	}
-
-	var req ServiceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
-		return
+	if cfg.IdleTimeout > 0 {
+		req.IdleTimeout = cfg.IdleTimeout.String()
 	}
+	req.HealthCheck.Enabled = cfg.HealthCheck.Enabled
+	req.HealthCheck.Path = cfg.HealthCheck.Path
+	req.HealthCheck.Interval = cfg.HealthCheck.Interval.String()
+	req.HealthCheck.Timeout = cfg.HealthCheck.Timeout.String()
+	req.HealthCheck.UnhealthyThreshold = cfg.HealthCheck.UnhealthyThreshold
+	req.HealthCheck.HealthyThreshold = cfg.HealthCheck.HealthyThreshold
+	req.HealthCheck.ExpectBody = cfg.HealthCheck.ExpectBody
+	req.TLS.Enabled = cfg.TLS.Enabled
+	req.TLS.SkipVerify = cfg.TLS.SkipVerify
+	return req
+}
 
-	// Convert to config.ServiceConfig
+// toServiceConfig converts the request to a config.ServiceConfig
+func (req ServiceRequest) toServiceConfig() (config.ServiceConfig, error) {
 	svcCfg := config.ServiceConfig{
-		Name:        req.Name,
-		Backend:     req.Backend,
-		Paths:       req.Paths,
-		StripPrefix: req.StripPrefix,
+		Name:            req.Name,
+		Mode:            req.Mode,
+		Ports:           req.Ports,
+		Listeners:       req.Listeners,
+		Backend:         req.Backend,
+		Backends:        req.Backends,
+		LoadBalancing:   req.LoadBalancing,
+		Paths:           req.Paths,
+		Routes:          req.Routes,
+		StripPrefix:     req.StripPrefix,
+		Rewrites:        req.Rewrites,
+		ResponseRewrite: req.ResponseRewrite,
+		HostHeader:      req.HostHeader,
+		TrustedProxies:  req.TrustedProxies,
+		RequestHeaders:  req.RequestHeaders,
+		ResponseHeaders: req.ResponseHeaders,
+		IdentityHeaders: req.IdentityHeaders,
+		Access:          req.Access,
+		HTTPRedirect:    req.HTTPRedirect,
+		HSTS:            req.HSTS,
+		Funnel:          req.Funnel,
 		TLS: config.TLSConfig{
 			Enabled:    req.TLS.Enabled,
 			SkipVerify: req.TLS.SkipVerify,
@@ -169,17 +321,23 @@ func (h *APIHandler) AddService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse duration strings
+	if req.IdleTimeout != "" {
+		idleTimeout, err := time.ParseDuration(req.IdleTimeout)
+		if err != nil {
+			return svcCfg, fmt.Errorf("invalid idleTimeout duration: %w", err)
+		}
+		svcCfg.IdleTimeout = idleTimeout
+	}
+
 	if req.HealthCheck.Enabled {
 		interval, err := time.ParseDuration(req.HealthCheck.Interval)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid interval duration: %v", err), http.StatusBadRequest)
-			return
+			return svcCfg, fmt.Errorf("invalid interval duration: %w", err)
 		}
 
 		timeout, err := time.ParseDuration(req.HealthCheck.Timeout)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid timeout duration: %v", err), http.StatusBadRequest)
-			return
+			return svcCfg, fmt.Errorf("invalid timeout duration: %w", err)
 		}
 
 		svcCfg.HealthCheck = config.HealthCheckConfig{
@@ -188,9 +346,44 @@ func (h *APIHandler) AddService(w http.ResponseWriter, r *http.Request) {
 			Interval:           interval,
 			Timeout:            timeout,
 			UnhealthyThreshold: req.HealthCheck.UnhealthyThreshold,
+			HealthyThreshold:   req.HealthCheck.HealthyThreshold,
+			ExpectBody:         req.HealthCheck.ExpectBody,
 		}
 	}
 
+	return svcCfg, nil
+}
+
+// AddService adds a new service
+func (h *APIHandler) AddService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	svcCfg, err := req.toServiceConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keep reloads out until the service is running and saved
+	h.reloader.Lock()
+	defer h.reloader.Unlock()
+
+	// Apply defaults and reject configurations that the next reload would
+	svcCfg, err = h.validateService(svcCfg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid service: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	// Add service to manager
 	if err := h.manager.AddService(svcCfg); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to add service: %v", err), http.StatusInternalServerError)
@@ -198,8 +391,10 @@ func (h *APIHandler) AddService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add to config and save
-	h.config.Services = append(h.config.Services, svcCfg)
-	if err := config.Save(h.config, h.configPath); err != nil {
+	err = h.reloader.Save(func(cfg *config.Config) {
+		cfg.Services = append(cfg.Services, svcCfg)
+	})
+	if err != nil {
 		log.Printf("Warning: Failed to save config after adding service: %v", err)
 	}
 
@@ -212,6 +407,199 @@ func (h *APIHandler) AddService(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// UpdateService replaces the configuration of an existing service (PUT)
+func (h *APIHandler) UpdateService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := serviceName(r)
+	if name == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+
+	svc, exists := h.manager.GetService(name)
+	if !exists {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+
+	var req ServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	req.keepFunnelAuth(svc.Config)
+
+	h.applyUpdate(w, name, req)
+}
+
+// keepFunnelAuth keeps the stored Funnel credentials when a replacement sends
+// none. GET never returns them, so a GET/PUT round trip would otherwise
+// leave the service publicly reachable without authentication.
+func (req *ServiceRequest) keepFunnelAuth(current config.ServiceConfig) {
+	if !req.Funnel.Auth.Required() {
+		req.Funnel.Auth = current.Funnel.Auth
+	}
+}
+
+// PatchService applies a JSON merge patch (RFC 7386) to an existing service (PATCH)
+func (h *APIHandler) PatchService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := serviceName(r)
+	if name == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+
+	svc, exists := h.manager.GetService(name)
+	if !exists {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+
+	var patch any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Apply the patch to the JSON form of the current configuration
+	current, err := json.Marshal(newServiceRequest(svc.Config))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode service: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var doc any
+	if err := json.Unmarshal(current, &doc); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to decode service: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to apply patch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req ServiceRequest
+	if err := json.Unmarshal(patched, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid patch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	h.applyUpdate(w, name, req)
+}
+
+// applyUpdate validates the requested configuration, swaps it into the
+// running service and persists it
+func (h *APIHandler) applyUpdate(w http.ResponseWriter, name string, req ServiceRequest) {
+	if req.Name == "" {
+		req.Name = name
+	}
+	if req.Name != name {
+		http.Error(w, "Service name cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	svcCfg, err := req.toServiceConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.reloader.Lock()
+	defer h.reloader.Unlock()
+
+	svcCfg, err = h.validateService(svcCfg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid service: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.manager.UpdateService(svcCfg); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update service: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Replace in config and save
+	err = h.reloader.Save(func(cfg *config.Config) {
+		for i, svc := range cfg.Services {
+			if svc.Name == name {
+				cfg.Services[i] = svcCfg
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to save config after updating service: %v", err)
+	}
+
+	log.Printf("Service %s updated via API", name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": fmt.Sprintf("Service %s updated successfully", name),
+	})
+}
+
+// validateService validates a service configuration against the rest of the
+// configuration and returns it with defaults applied
+func (h *APIHandler) validateService(svcCfg config.ServiceConfig) (config.ServiceConfig, error) {
+	current := h.reloader.Config()
+	candidate := current
+	candidate.Services = make([]config.ServiceConfig, 0, len(current.Services))
+	for _, svc := range current.Services {
+		if svc.Name != svcCfg.Name {
+			candidate.Services = append(candidate.Services, svc)
+		}
+	}
+	candidate.Services = append(candidate.Services, svcCfg)
+
+	if err := candidate.Validate(); err != nil {
+		return svcCfg, err
+	}
+	return candidate.Services[len(candidate.Services)-1], nil
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to a decoded JSON document
+func mergePatch(doc, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	docObj, ok := doc.(map[string]any)
+	if !ok {
+		docObj = make(map[string]any)
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(docObj, key)
+			continue
+		}
+		docObj[key] = mergePatch(docObj[key], value)
+	}
+	return docObj
+}
+
+// serviceName extracts the service name from paths like /api/services/{name}
+func serviceName(r *http.Request) string {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[3]
+}
+
 // DeleteService removes a service
 func (h *APIHandler) DeleteService(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -227,6 +615,9 @@ func (h *APIHandler) DeleteService(w http.ResponseWriter, r *http.Request) {
 	}
 	name := parts[3]
 
+	h.reloader.Lock()
+	defer h.reloader.Unlock()
+
 	// Remove from manager
 	if err := h.manager.RemoveService(name); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to remove service: %v", err), http.StatusInternalServerError)
@@ -234,15 +625,16 @@ func (h *APIHandler) DeleteService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Remove from config and save
-	newServices := make([]config.ServiceConfig, 0)
-	for _, svc := range h.config.Services {
-		if svc.Name != name {
-			newServices = append(newServices, svc)
+	err := h.reloader.Save(func(cfg *config.Config) {
+		newServices := make([]config.ServiceConfig, 0)
+		for _, svc := range cfg.Services {
+			if svc.Name != name {
+				newServices = append(newServices, svc)
+			}
 		}
-	}
-	h.config.Services = newServices
-
-	if err := config.Save(h.config, h.configPath); err != nil {
+		cfg.Services = newServices
+	})
+	if err != nil {
 		log.Printf("Warning: Failed to save config after removing service: %v", err)
 	}
 
@@ -267,3 +659,161 @@ func (h *APIHandler) HealthStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(statuses)
 }
+
+// HealthHistory returns the recent health checks of a service from
+// /api/services/{name}/health/history
+func (h *APIHandler) HealthHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := serviceName(r)
+	if _, exists := h.manager.GetService(name); !exists {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.healthChecker.History(name))
+}
+
+// ConfigStatus returns the outcome of the most recent configuration reload
+func (h *APIHandler) ConfigStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.reloader.Status())
+}
+
+// ReloadConfig reloads the configuration file and applies the changes
+func (h *APIHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The status carries the error details, so report it either way
+	status := http.StatusOK
+	if err := h.reloader.Reload(); err != nil {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(h.reloader.Status())
+}
+
+// ConfigHistory returns the stored configuration revisions
+func (h *APIHandler) ConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	revisions, err := h.reloader.History()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read config history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if revisions == nil {
+		revisions = []config.Revision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// RollbackConfig restores a configuration revision from /api/config/rollback/{rev}
+func (h *APIHandler) RollbackConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rev, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/config/rollback/"))
+	if err != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.reloader.Rollback(rev); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to roll back to revision %d: %v", rev, err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	log.Printf("Config rolled back to revision %d via API", rev)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": fmt.Sprintf("Rolled back to revision %d", rev),
+	})
+}
+
+// EventResponse represents a manager lifecycle event streamed to the UI
+type EventResponse struct {
+	Type      string `json:"type"`
+	Service   string `json:"service"`
+	Backend   string `json:"backend,omitempty"`
+	Healthy   bool   `json:"healthy"`
+	NodeState string `json:"nodeState,omitempty"`
+}
+
+// Events streams manager lifecycle events as server-sent events
+func (h *APIHandler) Events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.manager.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			eventResp := EventResponse{
+				Type:      string(event.Type),
+				Service:   event.Name,
+				Healthy:   event.Healthy,
+				NodeState: event.NodeState,
+			}
+			if event.Backend != nil {
+				eventResp.Backend = event.Backend.URL.String()
+			}
+			if event.Type != manager.EventHealthChanged && event.Service != nil {
+				eventResp.Healthy = event.Service.IsHealthy()
+			}
+
+			data, err := json.Marshal(eventResp)
+			if err != nil {
+				log.Printf("Failed to encode event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
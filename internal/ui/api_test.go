@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/config"
+	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+	"github.com/NathanBhanji/tsnet-proxy/internal/reload"
+)
+
+// newTestHandler returns an API handler whose reloader holds cfg. Requests
+// rejected before reaching the manager do not need one.
+func newTestHandler(t *testing.T, cfg *config.Config) *APIHandler {
+	t.Helper()
+	dir := t.TempDir()
+	cfg.StateDir = dir
+	return NewAPIHandler(nil, nil, reload.NewReloader(cfg, filepath.Join(dir, "services.yaml"), nil))
+}
+
+func TestAddServiceValidates(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing backend", `{"name": "app"}`},
+		{"unknown mode", `{"name": "app", "mode": "sctp", "backend": "http://app:80"}`},
+		{"tcp without ports", `{"name": "db", "mode": "tcp", "backend": "tcp://db:5432"}`},
+		{"bad backend scheme", `{"name": "app", "backend": "ftp://app"}`},
+		{"unknown load balancing", `{"name": "app", "backends": [{"url": "http://a:80"}, {"url": "http://b:80"}], "loadBalancing": "random"}`},
+		{"bad rewrite code", `{"name": "app", "backend": "http://app:80", "rewrites": [{"match": "^/old$", "redirect": "/new", "code": 200}]}`},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{
+			AuthKey:  "tskey-test",
+			Services: []config.ServiceConfig{{Name: "existing", Backend: "http://existing:80"}},
+		}
+		h := newTestHandler(t, cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/services", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		h.AddService(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, http.StatusBadRequest, rec.Body)
+		}
+	}
+}
+
+func TestValidateServiceAppliesDefaults(t *testing.T) {
+	h := newTestHandler(t, &config.Config{AuthKey: "tskey-test"})
+
+	svcCfg, err := h.validateService(config.ServiceConfig{
+		Name:     "app",
+		Backends: []config.BackendConfig{{URL: "http://a:80"}, {URL: "http://b:80"}},
+		Rewrites: []config.RewriteRule{{Match: "^/old$", Redirect: "/new"}},
+		HealthCheck: config.HealthCheckConfig{
+			Enabled: true,
+			Path:    "/health",
+		},
+	})
+	if err != nil {
+		t.Fatalf("validateService: %v", err)
+	}
+
+	if svcCfg.Mode != config.ModeHTTP {
+		t.Errorf("Mode = %q, want %q", svcCfg.Mode, config.ModeHTTP)
+	}
+	if svcCfg.LoadBalancing == "" {
+		t.Error("LoadBalancing was not defaulted")
+	}
+	if svcCfg.Rewrites[0].Code != http.StatusPermanentRedirect {
+		t.Errorf("rewrite Code = %d, want %d", svcCfg.Rewrites[0].Code, http.StatusPermanentRedirect)
+	}
+	if svcCfg.HealthCheck.Interval <= 0 || svcCfg.HealthCheck.Timeout <= 0 {
+		t.Errorf("health check durations were not defaulted: %+v", svcCfg.HealthCheck)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   any
+		patch any
+		want  any
+	}{
+		{
+			"replace value",
+			map[string]any{"backend": "http://a:80", "stripPrefix": true},
+			map[string]any{"backend": "http://b:80"},
+			map[string]any{"backend": "http://b:80", "stripPrefix": true},
+		},
+		{
+			"delete with null",
+			map[string]any{"backend": "http://a:80", "paths": []any{"/api"}},
+			map[string]any{"paths": nil},
+			map[string]any{"backend": "http://a:80"},
+		},
+		{
+			"merge nested object",
+			map[string]any{"healthCheck": map[string]any{"enabled": true, "path": "/health"}},
+			map[string]any{"healthCheck": map[string]any{"path": "/ready"}},
+			map[string]any{"healthCheck": map[string]any{"enabled": true, "path": "/ready"}},
+		},
+		{
+			"replace array",
+			map[string]any{"paths": []any{"/a", "/b"}},
+			map[string]any{"paths": []any{"/c"}},
+			map[string]any{"paths": []any{"/c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := mergePatch(tt.doc, tt.patch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergePatch = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPutRoundTripKeepsFunnelAuth(t *testing.T) {
+	auth := config.FunnelAuthConfig{
+		Users:  map[string]string{"github": "secret"},
+		Tokens: []string{"token"},
+	}
+	svc, err := manager.NewService(config.ServiceConfig{
+		Name:    "webhooks",
+		Mode:    config.ModeHTTP,
+		Backend: "http://receiver:8080",
+		Funnel:  config.FunnelConfig{Enabled: true, Port: 443, Auth: auth},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	// Send what GET returned back as a replacement
+	body, err := json.Marshal(newServiceResponse(svc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "secret") {
+		t.Fatalf("GET response exposes Funnel credentials: %s", body)
+	}
+
+	var req ServiceRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	req.keepFunnelAuth(svc.Config)
+
+	svcCfg, err := req.toServiceConfig()
+	if err != nil {
+		t.Fatalf("toServiceConfig: %v", err)
+	}
+	if !reflect.DeepEqual(svcCfg.Funnel.Auth, auth) {
+		t.Errorf("Funnel auth = %+v, want %+v", svcCfg.Funnel.Auth, auth)
+	}
+
+	// Credentials sent with the replacement take effect
+	req.Funnel.Auth = config.FunnelAuthConfig{Tokens: []string{"rotated"}}
+	req.keepFunnelAuth(svc.Config)
+	if got := req.Funnel.Auth.Tokens; len(got) != 1 || got[0] != "rotated" {
+		t.Errorf("new Funnel tokens = %v, want [rotated]", got)
+	}
+}
@@ -0,0 +1,172 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/NathanBhanji/tsnet-proxy/internal/access"
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// Role is the level of access a caller has to the management UI
+type Role string
+
+const (
+	RoleNone   Role = "none"
+	RoleViewer Role = "viewer"
+	RoleAdmin  Role = "admin"
+)
+
+type contextKey struct{}
+
+// WhoAmIResponse describes the caller of the management UI
+type WhoAmIResponse struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Node  string `json:"node"`
+	Role  Role   `json:"role"`
+}
+
+// authEnabled reports whether any admins or viewers are configured
+func (s *UIServer) authEnabled() bool {
+	return !s.config.ManagementUI.Admins.IsEmpty() || !s.config.ManagementUI.Viewers.IsEmpty()
+}
+
+// whoIs resolves the Tailscale identity of the caller
+func (s *UIServer) whoIs(r *http.Request) (*apitype.WhoIsResponse, error) {
+	lc, err := s.tsnetServer.LocalClient()
+	if err != nil {
+		return nil, err
+	}
+	return lc.WhoIs(r.Context(), r.RemoteAddr)
+}
+
+// role returns the role granted to the caller
+func (s *UIServer) role(who *apitype.WhoIsResponse) Role {
+	if !s.authEnabled() {
+		return RoleAdmin
+	}
+
+	groups := s.manager.Groups()
+	switch {
+	case access.Matches(s.config.ManagementUI.Admins, groups, who):
+		return RoleAdmin
+	case access.Matches(s.config.ManagementUI.Viewers, groups, who):
+		return RoleViewer
+	default:
+		return RoleNone
+	}
+}
+
+// authorize wraps the UI handler so that viewers may only read and admins
+// may also change the configuration
+func (s *UIServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Identity alone does not stop pages on other sites from driving an
+		// admin's browser, so changes must be same-origin JSON requests
+		if err := checkWriteRequest(r); err != nil {
+			log.Printf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, fmt.Sprintf("Forbidden: %v", err), http.StatusForbidden)
+			return
+		}
+
+		var who *apitype.WhoIsResponse
+		if s.authEnabled() {
+			var err error
+			who, err = s.whoIs(r)
+			if err != nil {
+				log.Printf("Failed to identify management UI caller %s: %v", r.RemoteAddr, err)
+				http.Error(w, "Forbidden: unable to identify caller", http.StatusForbidden)
+				return
+			}
+		}
+
+		role := s.role(who)
+		switch role {
+		case RoleNone:
+			log.Printf("Denied management UI access for %s", access.Describe(who))
+			http.Error(w, "Forbidden: not a viewer or admin", http.StatusForbidden)
+			return
+		case RoleViewer:
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				log.Printf("Denied %s %s for viewer %s", r.Method, r.URL.Path, access.Describe(who))
+				http.Error(w, "Forbidden: admin role required", http.StatusForbidden)
+				return
+			}
+		}
+
+		if who != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			log.Printf("%s %s by %s", r.Method, r.URL.Path, access.Describe(who))
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithWhoIs(r, who)))
+	})
+}
+
+// checkWriteRequest rejects state-changing requests that a browser could
+// have sent on behalf of another site: they must carry a JSON body type, which
+// forms cannot send without a CORS preflight, and must not come from a
+// cross-site origin
+func checkWriteRequest(r *http.Request) error {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("content type must be application/json")
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return fmt.Errorf("cross-site request")
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return fmt.Errorf("cross-origin request from %s", origin)
+		}
+	}
+	return nil
+}
+
+// contextWithWhoIs attaches the resolved caller to the request context
+func contextWithWhoIs(r *http.Request, who *apitype.WhoIsResponse) context.Context {
+	return context.WithValue(r.Context(), contextKey{}, who)
+}
+
+// whoIsFromContext returns the caller resolved by authorize, if any
+func whoIsFromContext(r *http.Request) *apitype.WhoIsResponse {
+	who, _ := r.Context().Value(contextKey{}).(*apitype.WhoIsResponse)
+	return who
+}
+
+// WhoAmI handles GET /api/whoami
+func (s *UIServer) WhoAmI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who := whoIsFromContext(r)
+	resp := WhoAmIResponse{Role: s.role(who)}
+	if who != nil {
+		if who.UserProfile != nil {
+			resp.Login = who.UserProfile.LoginName
+			resp.Name = who.UserProfile.DisplayName
+		}
+		if who.Node != nil {
+			resp.Node = who.Node.ComputedName
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckWriteRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		wantErr bool
+	}{
+		{"get", http.MethodGet, nil, false},
+		{"head", http.MethodHead, nil, false},
+		{"json from curl", http.MethodPost, map[string]string{"Content-Type": "application/json"}, false},
+		{"json with charset", http.MethodPatch, map[string]string{"Content-Type": "application/json; charset=utf-8"}, false},
+		{"same origin", http.MethodPost, map[string]string{"Content-Type": "application/json", "Origin": "http://ui.example.ts.net", "Sec-Fetch-Site": "same-origin"}, false},
+		{"no content type", http.MethodPost, nil, true},
+		{"form", http.MethodPost, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, true},
+		{"text plain", http.MethodPost, map[string]string{"Content-Type": "text/plain"}, true},
+		{"delete without content type", http.MethodDelete, nil, true},
+		{"cross-site fetch", http.MethodPost, map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "cross-site"}, true},
+		{"same-site fetch", http.MethodPost, map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "same-site"}, true},
+		{"other origin", http.MethodPost, map[string]string{"Content-Type": "application/json", "Origin": "https://evil.example.com"}, true},
+		{"null origin", http.MethodPost, map[string]string{"Content-Type": "application/json", "Origin": "null"}, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://ui.example.ts.net/api/config/reload", nil)
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+		if err := checkWriteRequest(r); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkWriteRequest() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
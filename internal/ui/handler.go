@@ -7,11 +7,13 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/NathanBhanji/tsnet-proxy/internal/config"
 	"github.com/NathanBhanji/tsnet-proxy/internal/health"
 	"github.com/NathanBhanji/tsnet-proxy/internal/manager"
+	"github.com/NathanBhanji/tsnet-proxy/internal/reload"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/tsnet"
 )
@@ -24,7 +26,6 @@ type UIServer struct {
 	tsnetServer   *tsnet.Server
 	apiHandler    *APIHandler
 	config        *config.Config
-	configPath    string
 	manager       *manager.Manager
 	healthChecker *health.Checker
 	apiClient     *tailscale.Client
@@ -32,7 +33,7 @@ type UIServer struct {
 }
 
 // NewUIServer creates a new UI server instance
-func NewUIServer(cfg *config.Config, configPath string, mgr *manager.Manager, checker *health.Checker, authKey, stateDir string) *UIServer {
+func NewUIServer(cfg *config.Config, reloader *reload.Reloader, mgr *manager.Manager, checker *health.Checker, authKey, stateDir string) *UIServer {
 	var apiClient *tailscale.Client
 	if cfg.APIKey != "" && cfg.Tailnet != "" {
 		apiClient = tailscale.NewClient(cfg.Tailnet, tailscale.APIKey(cfg.APIKey))
@@ -40,10 +41,9 @@ func NewUIServer(cfg *config.Config, configPath string, mgr *manager.Manager, ch
 
 	return &UIServer{
 		config:        cfg,
-		configPath:    configPath,
 		manager:       mgr,
 		healthChecker: checker,
-		apiHandler:    NewAPIHandler(mgr, checker, cfg, configPath),
+		apiHandler:    NewAPIHandler(mgr, checker, reloader),
 		apiClient:     apiClient,
 		tailnet:       cfg.Tailnet,
 		tsnetServer: &tsnet.Server{
@@ -82,7 +82,7 @@ func (s *UIServer) Start() error {
 	log.Printf("Connected to Tailscale! Status: %v", status.BackendState)
 
 	// Create listener
-	ln, err := s.tsnetServer.Listen("tcp", ":80")
+	ln, err := s.tsnetServer.Listen("tcp", fmt.Sprintf(":%d", s.config.ManagementUI.Port))
 	if err != nil {
 		s.tsnetServer.Close()
 		return err
@@ -104,9 +104,18 @@ func (s *UIServer) Start() error {
 	})
 
 	mux.HandleFunc("/api/services/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/health/history") {
+			s.apiHandler.HealthHistory(w, r)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			s.apiHandler.GetService(w, r)
+		case http.MethodPut:
+			s.apiHandler.UpdateService(w, r)
+		case http.MethodPatch:
+			s.apiHandler.PatchService(w, r)
 		case http.MethodDelete:
 			s.apiHandler.DeleteService(w, r)
 		default:
@@ -115,6 +124,12 @@ func (s *UIServer) Start() error {
 	})
 
 	mux.HandleFunc("/api/health", s.apiHandler.HealthStatus)
+	mux.HandleFunc("/api/events", s.apiHandler.Events)
+	mux.HandleFunc("/api/config/status", s.apiHandler.ConfigStatus)
+	mux.HandleFunc("/api/config/reload", s.apiHandler.ReloadConfig)
+	mux.HandleFunc("/api/config/history", s.apiHandler.ConfigHistory)
+	mux.HandleFunc("/api/config/rollback/", s.apiHandler.RollbackConfig)
+	mux.HandleFunc("/api/whoami", s.WhoAmI)
 
 	// Serve static files
 	staticFS, err := fs.Sub(staticFiles, "static")
@@ -123,10 +138,14 @@ func (s *UIServer) Start() error {
 	}
 	mux.Handle("/", http.FileServer(http.FS(staticFS)))
 
+	if !s.authEnabled() {
+		log.Printf("Warning: no managementUI admins or viewers configured, every tailnet caller has admin access")
+	}
+
 	// Start HTTP server in goroutine
 	go func() {
-		log.Printf("Management UI listening on http://%s.your-tailnet.ts.net", s.config.ManagementUI.Hostname)
-		if err := http.Serve(ln, mux); err != nil {
+		log.Printf("Management UI listening on http://%s.your-tailnet.ts.net:%d", s.config.ManagementUI.Hostname, s.config.ManagementUI.Port)
+		if err := http.Serve(ln, s.authorize(mux)); err != nil {
 			log.Printf("Management UI server error: %v", err)
 		}
 	}()
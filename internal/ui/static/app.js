@@ -1,6 +1,10 @@
 // State
 let services = [];
 let autoRefreshInterval = null;
+let eventSource = null;
+let reloadTimer = null;
+let editingService = null;
+let currentUser = { role: 'admin' };
 
 // DOM Elements
 const servicesList = document.getElementById('services-list');
@@ -14,18 +18,23 @@ const healthEnabled = document.getElementById('health-enabled');
 const healthCheckOptions = document.getElementById('health-check-options');
 const tlsEnabled = document.getElementById('tls-enabled');
 const tlsOptions = document.getElementById('tls-options');
+const modalTitle = document.getElementById('modal-title');
+const submitBtn = document.getElementById('submit-btn');
+const userInfo = document.getElementById('user-info');
 
 // Initialize
-document.addEventListener('DOMContentLoaded', () => {
+document.addEventListener('DOMContentLoaded', async () => {
+    await loadCurrentUser();
     loadServices();
-    startAutoRefresh();
+    subscribeEvents();
+    setInterval(loadHealthHistories, 30000);
 
     // Event listeners
-    addServiceBtn.addEventListener('click', () => modal.classList.remove('hidden'));
+    addServiceBtn.addEventListener('click', openAddModal);
     closeModal.addEventListener('click', () => modal.classList.add('hidden'));
     cancelBtn.addEventListener('click', () => modal.classList.add('hidden'));
     refreshBtn.addEventListener('click', loadServices);
-    addServiceForm.addEventListener('submit', handleAddService);
+    addServiceForm.addEventListener('submit', handleSubmitService);
 
     healthEnabled.addEventListener('change', (e) => {
         if (e.target.checked) {
@@ -51,6 +60,31 @@ document.addEventListener('DOMContentLoaded', () => {
     });
 });
 
+// Load the caller's identity and role
+async function loadCurrentUser() {
+    try {
+        const response = await fetch('/api/whoami');
+        if (!response.ok) throw new Error(await response.text());
+        currentUser = await response.json();
+    } catch (error) {
+        console.error('Error loading user:', error);
+        currentUser = { role: 'viewer' };
+    }
+
+    if (currentUser.login) {
+        userInfo.textContent = `Signed in as ${currentUser.name || currentUser.login} (${currentUser.role})`;
+        userInfo.classList.remove('hidden');
+    }
+    if (!isAdmin()) {
+        addServiceBtn.classList.add('hidden');
+    }
+}
+
+// Check whether the caller may change services
+function isAdmin() {
+    return currentUser.role === 'admin';
+}
+
 // Load services from API
 async function loadServices() {
     try {
@@ -59,11 +93,12 @@ async function loadServices() {
 
         services = await response.json();
         renderServices();
+        loadHealthHistories();
     } catch (error) {
         console.error('Error loading services:', error);
         servicesList.innerHTML = `
             <div class="text-center py-12">
-                <p class="text-red-600 mb-4">Failed to load services: ${error.message}</p>
+                <p class="text-red-600 mb-4">Failed to load services: ${escapeHTML(error.message)}</p>
                 <button onclick="loadServices()" class="px-4 py-2 bg-white border border-gray-300 rounded-lg hover:bg-gray-50">
                     Retry
                 </button>
@@ -84,28 +119,107 @@ function renderServices() {
         return;
     }
 
-    servicesList.innerHTML = services.map(service => `
-        <div class="bg-white rounded-lg shadow hover:shadow-lg transition-shadow p-6 border-l-4 ${service.healthy ? 'border-green-500' : 'border-red-500'}">
+    servicesList.innerHTML = services.map(service => {
+        const status = serviceStatus(service);
+        return `
+        <div class="bg-white rounded-lg shadow hover:shadow-lg transition-shadow p-6 border-l-4 ${status.border}">
             <div class="flex justify-between items-start mb-4">
                 <h3 class="text-xl font-bold flex items-center gap-2">
-                    <span class="${service.healthy ? 'text-green-500' : 'text-red-500'}">${service.healthy ? '🟢' : '🔴'}</span>
-                    ${service.name}
+                    <span>${status.icon}</span>
+                    ${escapeHTML(service.name)}
                 </h3>
-                <button onclick="deleteService('${service.name}')" class="px-4 py-2 bg-red-600 hover:bg-red-700 text-white rounded-lg text-sm font-medium transition">
-                    Delete
-                </button>
+                <div class="flex gap-2 ${isAdmin() ? '' : 'hidden'}">
+                    <button data-name="${escapeHTML(service.name)}" onclick="editService(this.dataset.name)" class="px-4 py-2 bg-white border border-gray-300 hover:bg-gray-50 rounded-lg text-sm font-medium transition">
+                        Edit
+                    </button>
+                    <button data-name="${escapeHTML(service.name)}" onclick="deleteService(this.dataset.name)" class="px-4 py-2 bg-red-600 hover:bg-red-700 text-white rounded-lg text-sm font-medium transition">
+                        Delete
+                    </button>
+                </div>
             </div>
 
             <div class="space-y-2 text-sm">
+                ${isL4(service) ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Mode:</span>
+                        <span class="text-gray-900">${service.mode.toUpperCase()} (idle timeout ${service.idleTimeout})</span>
+                    </div>
+
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Traffic:</span>
+                        <span class="text-gray-900">${service.backends.reduce((n, b) => n + b.activeRequests, 0)} open ${service.mode === 'udp' ? 'sessions' : 'connections'}, ${formatBytes(service.backends.reduce((n, b) => n + b.bytesSent, 0))} sent, ${formatBytes(service.backends.reduce((n, b) => n + b.bytesReceived, 0))} received</span>
+                    </div>
+                ` : ''}
+
                 <div class="flex gap-4">
-                    <span class="font-semibold text-gray-600 min-w-[140px]">Backend:</span>
-                    <span class="text-gray-900">${service.backend}</span>
+                    <span class="font-semibold text-gray-600 min-w-[140px]">Listeners:</span>
+                    <span class="text-gray-900">${service.listeners.map(l => `${l.protocol.toUpperCase()} ${l.port}${l.backend ? ` → ${escapeHTML(l.backend)}` : ''}`).join(', ')}</span>
                 </div>
 
+                ${service.backends.length > 1 ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Backends:</span>
+                        <div class="space-y-1">
+                            ${service.backends.map(backend => `
+                                <div class="text-gray-900" title="${escapeHTML(backend.lastError || '')}">
+                                    ${backend.healthy ? '🟢' : '🔴'} ${escapeHTML(backend.url)}
+                                    <span class="text-gray-500">(${backend.activeRequests} active${service.loadBalancing === 'weighted' ? `, weight ${backend.weight}` : ''}${backend.consecutiveFailures > 0 ? `, ${backend.consecutiveFailures} failed checks` : ''})</span>
+                                </div>
+                            `).join('')}
+                        </div>
+                    </div>
+
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Load Balancing:</span>
+                        <span class="text-gray-900">${escapeHTML(service.loadBalancing)}</span>
+                    </div>
+                ` : service.backends.length > 0 ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Backend:</span>
+                        <span class="text-gray-900">${escapeHTML(service.backends[0].url)}</span>
+                    </div>
+                ` : ''}
+
+                ${service.routeBackends && service.routeBackends.length > 0 ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Route Backends:</span>
+                        <div class="space-y-1">
+                            ${service.routeBackends.map(backend => `
+                                <div class="text-gray-900" title="${escapeHTML(backend.lastError || '')}">
+                                    ${backend.healthy ? '🟢' : '🔴'} ${escapeHTML(backend.url)}
+                                    <span class="text-gray-500">(${backend.activeRequests} active${backend.consecutiveFailures > 0 ? `, ${backend.consecutiveFailures} failed checks` : ''})</span>
+                                </div>
+                            `).join('')}
+                        </div>
+                    </div>
+                ` : ''}
+
                 ${service.paths && service.paths.length > 0 ? `
                     <div class="flex gap-4">
                         <span class="font-semibold text-gray-600 min-w-[140px]">Paths:</span>
-                        <span class="text-gray-900">${service.paths.join(', ')}</span>
+                        <span class="text-gray-900">${escapeHTML(service.paths.join(', '))}</span>
+                    </div>
+                ` : ''}
+
+                ${service.routes && service.routes.length > 0 ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Routes:</span>
+                        <div class="space-y-1">
+                            ${service.routes.map(route => `
+                                <div class="text-gray-900">${escapeHTML(describeRoute(route))} → ${escapeHTML(describeRouteTarget(route))}</div>
+                            `).join('')}
+                        </div>
+                    </div>
+                ` : ''}
+
+                ${service.rewrites && service.rewrites.length > 0 ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Rewrites:</span>
+                        <div class="flex flex-col gap-1">
+                            ${service.rewrites.map(rule => `
+                                <div class="text-gray-900">${escapeHTML(describeRewrite(rule))}</div>
+                            `).join('')}
+                        </div>
                     </div>
                 ` : ''}
 
@@ -116,10 +230,80 @@ function renderServices() {
                     </div>
                 ` : ''}
 
+                ${service.responseRewrite.enabled ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Response Rewrite:</span>
+                        <span class="text-gray-900">${service.responseRewrite.body ? 'Headers and HTML/CSS links' : 'Headers'}</span>
+                    </div>
+                ` : ''}
+
+                ${service.hostHeader.mode && service.hostHeader.mode !== 'preserve' ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Host Header:</span>
+                        <span class="text-gray-900">${service.hostHeader.mode === 'custom' ? escapeHTML(service.hostHeader.value) : 'Backend host'}</span>
+                    </div>
+                ` : ''}
+
+                ${service.trustedProxies && service.trustedProxies.length > 0 ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Trusted Proxies:</span>
+                        <span class="text-gray-900">${escapeHTML(service.trustedProxies.join(', '))}</span>
+                    </div>
+                ` : ''}
+
+                ${hasHeaderRules(service.requestHeaders) || hasHeaderRules(service.responseHeaders) ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Header Rules:</span>
+                        <div class="flex flex-col gap-1">
+                            ${describeHeaderRules('Request', service.requestHeaders)}
+                            ${describeHeaderRules('Response', service.responseHeaders)}
+                        </div>
+                    </div>
+                ` : ''}
+
+                ${service.identityHeaders ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Identity Headers:</span>
+                        <span class="text-gray-900">Yes</span>
+                    </div>
+                ` : ''}
+
+                ${service.httpRedirect.mode && service.httpRedirect.mode !== 'serve' ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Plain HTTP:</span>
+                        <span class="text-gray-900">${service.httpRedirect.mode === 'redirect' ? `Redirect to HTTPS (${service.httpRedirect.code})` : 'Disabled'}</span>
+                    </div>
+                ` : ''}
+
+                ${service.funnel.enabled ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Funnel:</span>
+                        <span class="text-gray-900">🌐 Public on port ${service.funnel.port}${service.funnel.paths && service.funnel.paths.length > 0 ? ` (${escapeHTML(service.funnel.paths.join(', '))})` : ''}${service.funnel.authRequired ? ', auth required' : ''}</span>
+                    </div>
+                ` : ''}
+
+                ${service.hsts.enabled ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">HSTS:</span>
+                        <span class="text-gray-900">max-age=${service.hsts.maxAge}</span>
+                    </div>
+                ` : ''}
+
+                ${hasAccessRules(service.access) ? `
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Access:</span>
+                        <span class="text-gray-900">Restricted${service.access.paths && service.access.paths.length > 0 ? ` (${escapeHTML(service.access.paths.map(p => p.prefix).join(', '))})` : ''}</span>
+                    </div>
+                ` : ''}
+
                 ${service.healthCheck.enabled ? `
                     <div class="flex gap-4">
                         <span class="font-semibold text-gray-600 min-w-[140px]">Health Check:</span>
-                        <span class="text-gray-900">${service.healthCheck.path} (${service.healthCheck.interval})</span>
+                        <span class="text-gray-900">${service.mode === 'tcp' ? 'TCP connect' : escapeHTML(service.healthCheck.path)} (${service.healthCheck.interval})</span>
+                    </div>
+                    <div class="flex gap-4">
+                        <span class="font-semibold text-gray-600 min-w-[140px]">Recent Checks:</span>
+                        <div id="health-history-${escapeHTML(service.name)}" class="text-gray-500">Loading...</div>
                     </div>
                 ` : `
                     <div class="flex gap-4">
@@ -137,15 +321,192 @@ function renderServices() {
 
                 <div class="flex gap-4">
                     <span class="font-semibold text-gray-600 min-w-[140px]">Tailscale URL:</span>
-                    <code class="text-indigo-600 bg-gray-50 px-2 py-1 rounded">https://${service.name}.your-tailnet.ts.net</code>
+                    <code class="text-indigo-600 bg-gray-50 px-2 py-1 rounded">${escapeHTML(isL4(service) ? `${service.name}.your-tailnet.ts.net:${service.listeners[0].port}` : `https://${service.name}.your-tailnet.ts.net`)}</code>
                 </div>
             </div>
         </div>
-    `).join('');
+    `;
+    }).join('');
+}
+
+// Load the health check history of every service with health checks
+async function loadHealthHistories() {
+    for (const service of services.filter(s => s.healthCheck.enabled)) {
+        try {
+            const response = await fetch(`/api/services/${encodeURIComponent(service.name)}/health/history`);
+            if (!response.ok) continue;
+            const history = await response.json();
+            const container = document.getElementById(`health-history-${service.name}`);
+            if (container) container.innerHTML = renderSparkline(history);
+        } catch (error) {
+            console.error(`Error loading health history for ${service.name}:`, error);
+        }
+    }
+}
+
+// Render check latencies as a sparkline with failed checks marked in red
+function renderSparkline(history) {
+    if (history.length === 0) return 'No checks yet';
+
+    const width = 200, height = 32, pad = 3;
+    const max = Math.max(...history.map(c => c.latencyMs), 1);
+    const x = i => history.length === 1 ? width / 2 : pad + i * (width - 2 * pad) / (history.length - 1);
+    const y = c => height - pad - (c.latencyMs / max) * (height - 2 * pad);
+    const points = history.map((c, i) => `${x(i).toFixed(1)},${y(c).toFixed(1)}`).join(' ');
+    const failures = history.map((c, i) => c.result === 'healthy' ? '' :
+        `<circle cx="${x(i).toFixed(1)}" cy="${y(c).toFixed(1)}" r="2.5" fill="#dc2626"><title>${escapeHTML(`${c.backend}: ${c.result}`)}</title></circle>`).join('');
+    const last = history[history.length - 1];
+    const failed = history.filter(c => c.result !== 'healthy').length;
+
+    return `
+        <div class="flex items-center gap-3">
+            <svg width="${width}" height="${height}" class="bg-gray-50 rounded">
+                <polyline points="${points}" fill="none" stroke="#4f46e5" stroke-width="1.5"/>
+                ${failures}
+            </svg>
+            <span class="text-sm text-gray-600">${last.latencyMs.toFixed(1)} ms, ${failed}/${history.length} failed</span>
+        </div>
+    `;
+}
+
+// Summarize the conditions of a route
+function describeRoute(route) {
+    const match = route.match;
+    const parts = [];
+    if (match.methods && match.methods.length > 0) parts.push(match.methods.join('|'));
+    if (match.host) parts.push(match.host);
+    parts.push(match.pathPrefix ? `${match.pathPrefix}*` : match.path || (match.pathRegex ? `~ ${match.pathRegex}` : '*'));
+    if (match.headers) parts.push(...Object.entries(match.headers).map(([name, value]) => value ? `${name}: ${value}` : name));
+    return `${route.name ? `${route.name}: ` : ''}${parts.join(' ')}`;
+}
+
+// Check whether header rules change anything
+function hasHeaderRules(rules) {
+    return rules && (Object.keys(rules.set || {}).length > 0 || Object.keys(rules.add || {}).length > 0 || (rules.remove || []).length > 0);
+}
+
+// Describe header rules as HTML, one line per operation
+function describeHeaderRules(label, rules) {
+    if (!hasHeaderRules(rules)) return '';
+    const lines = [
+        ...(rules.remove || []).map(name => `remove ${name}`),
+        ...Object.entries(rules.set || {}).map(([name, value]) => `set ${name}: ${value}`),
+        ...Object.entries(rules.add || {}).map(([name, value]) => `add ${name}: ${value}`)
+    ];
+    return lines.map(line => `<div class="text-gray-900">${label}: ${escapeHTML(line)}</div>`).join('');
+}
+
+// Describe where a route sends requests
+function describeRouteTarget(route) {
+    const backends = route.backend ? [route.backend] : (route.backends || []).map(b => b.url);
+    const rewrites = (route.rewrites || []).map(describeRewrite);
+    return [...rewrites, ...backends].join(', ');
+}
+
+// Describe a rewrite rule
+function describeRewrite(rule) {
+    const match = rule.match ? `~ ${rule.match} ` : '';
+    if (rule.redirect) return `${match}redirect ${rule.code} ${rule.redirect}`;
+    if (rule.addPrefix) return `${match}add prefix ${rule.addPrefix}`;
+    return `${match}rewrite to ${rule.replace}`;
+}
+
+// Check whether a service forwards raw TCP or UDP traffic
+function isL4(service) {
+    return service.mode === 'tcp' || service.mode === 'udp';
+}
+
+// Format a byte count for display
+function formatBytes(bytes) {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+        bytes /= 1024;
+        i++;
+    }
+    return `${i === 0 ? bytes : bytes.toFixed(1)} ${units[i]}`;
+}
+
+// Escape text for use in HTML content and attribute values
+function escapeHTML(text) {
+    return String(text).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[c]);
+}
+
+// Check whether a service has any access rules configured
+function hasAccessRules(access) {
+    const matchEmpty = m => !m || ['users', 'groups', 'tags', 'capabilities'].every(k => !m[k] || m[k].length === 0);
+    return access && (!matchEmpty(access.allow) || !matchEmpty(access.deny) || (access.paths && access.paths.length > 0));
+}
+
+// Summarize service health: healthy, degraded (some backends down) or unhealthy
+function serviceStatus(service) {
+    const unhealthy = [...service.backends, ...(service.routeBackends || [])].filter(backend => !backend.healthy).length;
+    if (!service.healthy) {
+        return { icon: '🔴', border: 'border-red-500' };
+    }
+    if (unhealthy > 0) {
+        return { icon: '🟡', border: 'border-yellow-500' };
+    }
+    return { icon: '🟢', border: 'border-green-500' };
 }
 
-// Handle add service form submission
-async function handleAddService(e) {
+// Open the modal to add a new service
+function openAddModal() {
+    editingService = null;
+    addServiceForm.reset();
+    addServiceForm.elements.name.readOnly = false;
+    addServiceForm.elements.backend.required = true;
+    healthCheckOptions.classList.remove('hidden');
+    tlsOptions.classList.add('hidden');
+    modalTitle.textContent = 'Add New Service';
+    submitBtn.textContent = 'Add Service';
+    modal.classList.remove('hidden');
+}
+
+// Open the modal pre-filled with an existing service's configuration
+function editService(name) {
+    const service = services.find(s => s.name === name);
+    if (!service) return;
+
+    editingService = name;
+    addServiceForm.reset();
+
+    const fields = addServiceForm.elements;
+    // Only the default backends are edited here, route backends belong to routes
+    const backendURLs = service.backends.map(backend => backend.url);
+    fields.name.value = service.name;
+    fields.name.readOnly = true;
+    fields.backend.value = backendURLs[0] || '';
+    fields.backend.required = !(service.routes && service.routes.length > 0);
+    fields.extraBackends.value = backendURLs.slice(1).join(', ');
+    fields.loadBalancing.value = service.loadBalancing || 'round-robin';
+    fields.paths.value = (service.paths || []).join(', ');
+    fields.stripPrefix.checked = service.stripPrefix;
+    fields.responseRewrite.value = !service.responseRewrite.enabled ? 'off' : (service.responseRewrite.body ? 'body' : 'headers');
+    fields.identityHeaders.checked = service.identityHeaders;
+    fields.httpRedirect.value = service.httpRedirect.mode || 'serve';
+    fields.hsts.checked = service.hsts.enabled;
+
+    fields.healthCheckEnabled.checked = service.healthCheck.enabled;
+    if (service.healthCheck.enabled) {
+        fields.healthCheckPath.value = service.healthCheck.path;
+        fields.healthCheckInterval.value = service.healthCheck.interval;
+        fields.healthCheckTimeout.value = service.healthCheck.timeout;
+        fields.healthCheckThreshold.value = service.healthCheck.unhealthyThreshold;
+    }
+    healthCheckOptions.classList.toggle('hidden', !service.healthCheck.enabled);
+
+    fields.tlsEnabled.checked = service.tls.enabled;
+    fields.tlsSkipVerify.checked = service.tls.skipVerify;
+    tlsOptions.classList.toggle('hidden', !service.tls.enabled);
+
+    modalTitle.textContent = `Edit ${service.name}`;
+    submitBtn.textContent = 'Save Changes';
+    modal.classList.remove('hidden');
+}
+
+// Handle add/edit service form submission
+async function handleSubmitService(e) {
     e.preventDefault();
 
     const formData = new FormData(e.target);
@@ -154,12 +515,31 @@ async function handleAddService(e) {
     const pathsInput = formData.get('paths');
     const paths = pathsInput ? pathsInput.split(',').map(p => p.trim()).filter(p => p) : [];
 
+    // Parse additional backends
+    const extraInput = formData.get('extraBackends');
+    const extraBackends = extraInput ? extraInput.split(',').map(b => b.trim()).filter(b => b) : [];
+
     // Build service config
     const serviceConfig = {
         name: formData.get('name'),
-        backend: formData.get('backend'),
+        backend: extraBackends.length > 0 ? '' : formData.get('backend'),
+        backends: extraBackends.length > 0
+            ? [formData.get('backend'), ...extraBackends].map(url => ({ url: url, weight: backendWeight(url) }))
+            : [],
+        loadBalancing: formData.get('loadBalancing'),
         paths: paths,
         stripPrefix: formData.get('stripPrefix') === 'on',
+        responseRewrite: {
+            enabled: formData.get('responseRewrite') !== 'off',
+            body: formData.get('responseRewrite') === 'body'
+        },
+        identityHeaders: formData.get('identityHeaders') === 'on',
+        httpRedirect: {
+            mode: formData.get('httpRedirect')
+        },
+        hsts: {
+            enabled: formData.get('hsts') === 'on'
+        },
         healthCheck: {
             enabled: formData.get('healthCheckEnabled') === 'on',
             path: formData.get('healthCheckPath') || '/health',
@@ -173,9 +553,12 @@ async function handleAddService(e) {
         }
     };
 
+    const action = editingService ? 'update' : 'add';
+
     try {
-        const response = await fetch('/api/services', {
-            method: 'POST',
+        // Edits are sent as a merge patch so settings without form fields are kept
+        const response = await fetch(editingService ? `/api/services/${encodeURIComponent(editingService)}` : '/api/services', {
+            method: editingService ? 'PATCH' : 'POST',
             headers: {
                 'Content-Type': 'application/json'
             },
@@ -190,15 +573,23 @@ async function handleAddService(e) {
         // Success - close modal and reload services
         modal.classList.add('hidden');
         addServiceForm.reset();
+        editingService = null;
         await loadServices();
 
-        showNotification(`Service ${serviceConfig.name} added successfully!`, 'success');
+        showNotification(`Service ${serviceConfig.name} ${action === 'add' ? 'added' : 'updated'} successfully!`, 'success');
     } catch (error) {
-        console.error('Error adding service:', error);
-        showNotification(`Failed to add service: ${error.message}`, 'error');
+        console.error(`Error ${action === 'add' ? 'adding' : 'updating'} service:`, error);
+        showNotification(`Failed to ${action} service: ${error.message}`, 'error');
     }
 }
 
+// Keep the existing weight of a backend when editing a service
+function backendWeight(url) {
+    const service = services.find(s => s.name === editingService);
+    const backend = service ? service.backends.find(b => b.url === url) : null;
+    return backend ? backend.weight : 1;
+}
+
 // Delete service
 async function deleteService(name) {
     if (!confirm(`Are you sure you want to delete service "${name}"?`)) {
@@ -206,8 +597,11 @@ async function deleteService(name) {
     }
 
     try {
-        const response = await fetch(`/api/services/${name}`, {
-            method: 'DELETE'
+        const response = await fetch(`/api/services/${encodeURIComponent(name)}`, {
+            method: 'DELETE',
+            headers: {
+                'Content-Type': 'application/json'
+            }
         });
 
         if (!response.ok) {
@@ -248,6 +642,28 @@ function showNotification(message, type = 'info') {
     }, 3000);
 }
 
+// Reload services whenever the server reports a lifecycle event
+function subscribeEvents() {
+    if (!window.EventSource) {
+        startAutoRefresh();
+        return;
+    }
+
+    eventSource = new EventSource('/api/events');
+    eventSource.onopen = () => stopAutoRefresh();
+    eventSource.onmessage = () => {
+        // Coalesce bursts of events into a single reload
+        clearTimeout(reloadTimer);
+        reloadTimer = setTimeout(loadServices, 250);
+    };
+    eventSource.onerror = () => {
+        // Fall back to polling while the browser reconnects
+        if (!autoRefreshInterval) {
+            startAutoRefresh();
+        }
+    };
+}
+
 // Auto-refresh services every 5 seconds
 function startAutoRefresh() {
     autoRefreshInterval = setInterval(loadServices, 5000);
@@ -257,5 +673,6 @@ function startAutoRefresh() {
 function stopAutoRefresh() {
     if (autoRefreshInterval) {
         clearInterval(autoRefreshInterval);
+        autoRefreshInterval = null;
     }
 }